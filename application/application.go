@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/sirupsen/logrus"
+	"github.com/vvhq/exorsus/events"
 	"io/ioutil"
 	"strings"
 	"sync"
@@ -21,16 +22,46 @@ type PreStart struct {
 	Timeout   int    `json:"timeout"`
 }
 
+// Multiline joins continuation lines (e.g. stack traces) into one entry.
+// A line continues the previous entry when it does not match Pattern, or,
+// with Indent, when it starts with whitespace. FlushTimeout is in milliseconds.
+type Multiline struct {
+	Pattern      string `json:"pattern"`
+	Indent       bool   `json:"indent"`
+	MaxLines     int    `json:"max_lines"`
+	FlushTimeout int    `json:"flush_timeout"`
+}
+
+// EventListener makes the application an event listener: after every READY
+// line it prints, exorsus writes one matching event as a JSON line to its
+// stdin and waits for an OK or FAIL line; a failed event is sent again.
+// Empty Events and Applications lists match all events.
+type EventListener struct {
+	Enabled      bool     `json:"enabled"`
+	Events       []string `json:"events"`
+	Applications []string `json:"applications"`
+}
+
 type Application struct {
-	Name        string        `json:"name"`
-	Command     string        `json:"command"`
-	Arguments   string        `json:"arguments"`
-	WorkDir     string        `json:"workdir"`
-	Timeout     int           `json:"timeout"`
-	User        string        `json:"user"`
-	Group       string        `json:"group"`
-	Environment []Environment `json:"environment"`
-	PreStart    PreStart      `json:"prestart"`
+	Name         string        `json:"name"`
+	Command      string        `json:"command"`
+	Arguments    string        `json:"arguments"`
+	WorkDir      string        `json:"workdir"`
+	Timeout      int           `json:"timeout"`
+	User         string        `json:"user"`
+	Group        string        `json:"group"`
+	Environment  []Environment `json:"environment"`
+	PreStart     PreStart      `json:"prestart"`
+	Mirror       string        `json:"mirror"`
+	LogFormat    string        `json:"log_format"`
+	Multiline    Multiline     `json:"multiline"`
+	MaxLines     int           `json:"max_lines"`
+	MaxBytes     int           `json:"max_bytes"`
+	Listener     EventListener `json:"event_listener"`
+	Required     bool          `json:"required"`
+	ProcessGroup bool          `json:"process_group"`
+	Stdin        string        `json:"stdin"`
+	Tty          bool          `json:"tty"`
 }
 
 func (app *Application) Copy() (*Application, error) {
@@ -49,6 +80,7 @@ func (app *Application) Copy() (*Application, error) {
 type Storage struct {
 	applications sync.Map
 	path         string
+	bus          *events.Bus
 	lock         sync.Mutex
 	logger       *logrus.Logger
 }
@@ -60,6 +92,7 @@ func (store *Storage) Add(applicationConfiguration Application) error {
 	}
 	store.applications.Store(applicationConfiguration.Name, applicationConfiguration)
 	store.replace()
+	store.publish(applicationConfiguration.Name, "added")
 	return nil
 }
 
@@ -73,6 +106,7 @@ func (store *Storage) Update(name string, applicationConfiguration Application)
 	}
 	store.applications.Store(applicationConfiguration.Name, applicationConfiguration)
 	store.replace()
+	store.publish(applicationConfiguration.Name, "updated")
 	return nil
 }
 
@@ -92,6 +126,7 @@ func (store *Storage) Delete(name string) error {
 	}
 	store.applications.Delete(name)
 	store.replace()
+	store.publish(name, "deleted")
 	return nil
 }
 
@@ -132,6 +167,10 @@ func (store *Storage) Load() {
 	}
 }
 
+func (store *Storage) publish(name string, change string) {
+	store.bus.Publish(events.Event{Type: events.TypeConfigChanged, Application: name, Message: change})
+}
+
 func (store *Storage) replace() {
 	store.lock.Lock()
 	defer store.lock.Unlock()
@@ -163,8 +202,8 @@ func (store *Storage) replace() {
 	}
 }
 
-func NewStorage(storePath string, logger *logrus.Logger) *Storage {
-	store := Storage{logger: logger, path: storePath}
+func NewStorage(storePath string, bus *events.Bus, logger *logrus.Logger) *Storage {
+	store := Storage{logger: logger, path: storePath, bus: bus}
 	store.Load()
 	return &store
 }
@@ -1,13 +1,18 @@
 package configuration
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"io/ioutil"
 	"os"
 	"path"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const DefaultConfigPath string = "./config/"
@@ -18,32 +23,311 @@ const DefaultLogMaxBackups int = 30
 const DefaultLogMaxAge int = 28
 const DefaultLogLocalTime bool = true
 const DefaultStdLinesCount int = 500
+const DefaultStdBytesCount int = 1024 * 1024
 const DefaultStdDateLayout = "2006-01-02 15:04:05"
 const DefaultStdDatePrefix = "["
 const DefaultStdDateSuffix = "]"
 const DefaultShutdownTimeout int = 4
 const DefaultListenPort int = 5202
+const DefaultListenSocketMode os.FileMode = 0660
 const DefaultConfigurationFileName string = "config.json"
 const DefaultLogFileName string = "log.json"
 const DefaultApplicationsFileName string = "applications.json"
+const DefaultTokenFileName string = "tokens.json"
 const DefaultPidPath string = "/tmp/"
 const DefaultPidFileName string = "exorsus.pid"
+const DefaultMirrorOutput string = MirrorOff
+const DefaultMirrorColor bool = false
+
+const DefaultSinkBatchSize int = 100
+const DefaultSinkBatchWait int = 1000
+const DefaultSinkBufferSize int = 10000
+const DefaultSinkRetries int = 3
+const DefaultSinkRetryWait int = 500
+const DefaultSinkTimeout int = 5
+
+const SinkSyslog string = "syslog"
+const SinkGELF string = "gelf"
+const SinkLoki string = "loki"
+
+const SinkIncludeAll string = "all"
+const SinkIncludeLog string = "log"
+const SinkIncludeOutput string = "output"
+
+const DefaultMultilineMaxLines int = 500
+const DefaultMultilineFlushTimeout int = 1000
+
+const DefaultSearchMaxResults int = 100
+const DefaultSearchTimeout int = 2
+const DefaultSearchMaxContext int = 10
+const DefaultSearchMaxDiskBytes int64 = 16 * 1024 * 1024
+
+const DefaultOperationRetention int = 3600
+const DefaultOperationTimeout int = 600
+
+const DefaultEventReplaySize int = 256
+
+const DefaultCrashLoopCount int = 3
+const DefaultCrashLoopWindow int = 60
+
+const DefaultWebhookBufferSize int = 1000
+const DefaultWebhookRetries int = 5
+const DefaultWebhookRetryWait int = 1000
+const DefaultWebhookMaxRetryWait int = 60000
+const DefaultWebhookTimeout int = 10
+const DefaultWebhookStderrLines int = 20
+const DefaultWebhookDeadLetterFileName string = "webhooks_dead.json"
+const DefaultAuditLogFileName string = "audit.json"
+
+const DefaultExecTimeout int = 60
+const DefaultExecMaxOutput int = 1024 * 1024
+
+const LogFormatText string = "text"
+const LogFormatJSON string = "json"
+const LogFormatLogfmt string = "logfmt"
+
+const MirrorOff string = "off"
+const MirrorPrefixed string = "prefixed"
+const MirrorRaw string = "raw"
+
+const StdinNone string = "none"
+const StdinPipe string = "pipe"
+
+// Sink describes a log forwarding destination. BatchWait and RetryWait are
+// in milliseconds, Timeout is in seconds; zero values fall back to defaults.
+// Facility is the syslog facility from 0 (kern) to 23 (local7), user when
+// it is not set.
+type Sink struct {
+	Name       string
+	Type       string
+	Network    string
+	Address    string
+	Include    string
+	Facility   *int
+	Tenant     string
+	Labels     map[string]string
+	BatchSize  int
+	BatchWait  int
+	BufferSize int
+	Retries    int
+	RetryWait  int
+	Timeout    int
+}
+
+func (sink *Sink) GetBatchSize() int {
+	if sink.BatchSize <= 0 {
+		return DefaultSinkBatchSize
+	}
+	return sink.BatchSize
+}
+
+func (sink *Sink) GetBatchWait() time.Duration {
+	if sink.BatchWait <= 0 {
+		return time.Duration(DefaultSinkBatchWait) * time.Millisecond
+	}
+	return time.Duration(sink.BatchWait) * time.Millisecond
+}
+
+func (sink *Sink) GetBufferSize() int {
+	if sink.BufferSize <= 0 {
+		return DefaultSinkBufferSize
+	}
+	return sink.BufferSize
+}
+
+func (sink *Sink) GetRetries() int {
+	if sink.Retries < 0 {
+		return 0
+	}
+	if sink.Retries == 0 {
+		return DefaultSinkRetries
+	}
+	return sink.Retries
+}
+
+func (sink *Sink) GetRetryWait() time.Duration {
+	if sink.RetryWait <= 0 {
+		return time.Duration(DefaultSinkRetryWait) * time.Millisecond
+	}
+	return time.Duration(sink.RetryWait) * time.Millisecond
+}
+
+func (sink *Sink) GetTimeout() time.Duration {
+	if sink.Timeout <= 0 {
+		return time.Duration(DefaultSinkTimeout) * time.Second
+	}
+	return time.Duration(sink.Timeout) * time.Second
+}
+
+func (sink *Sink) GetInclude() string {
+	switch sink.Include {
+	case SinkIncludeLog, SinkIncludeOutput:
+		return sink.Include
+	default:
+		return SinkIncludeAll
+	}
+}
+
+// Webhook describes an HTTP endpoint which receives process events as JSON.
+// Events and Applications filter the events (empty lists match all); when
+// Secret is set the body is signed with HMAC-SHA256. RetryWait is in
+// milliseconds and doubles after every attempt, Timeout is in seconds.
+type Webhook struct {
+	Name         string
+	URL          string
+	Events       []string
+	Applications []string
+	Headers      map[string]string
+	Secret       string
+	StderrLines  int
+	BufferSize   int
+	Retries      int
+	RetryWait    int
+	Timeout      int
+}
+
+func (webhook *Webhook) GetStderrLines() int {
+	if webhook.StderrLines < 0 {
+		return 0
+	}
+	if webhook.StderrLines == 0 {
+		return DefaultWebhookStderrLines
+	}
+	return webhook.StderrLines
+}
+
+func (webhook *Webhook) GetBufferSize() int {
+	if webhook.BufferSize <= 0 {
+		return DefaultWebhookBufferSize
+	}
+	return webhook.BufferSize
+}
+
+func (webhook *Webhook) GetRetries() int {
+	if webhook.Retries < 0 {
+		return 0
+	}
+	if webhook.Retries == 0 {
+		return DefaultWebhookRetries
+	}
+	return webhook.Retries
+}
+
+// GetRetryWait returns the wait before the given retry (counted from 1).
+func (webhook *Webhook) GetRetryWait(retry int) time.Duration {
+	wait := time.Duration(webhook.RetryWait) * time.Millisecond
+	if webhook.RetryWait <= 0 {
+		wait = time.Duration(DefaultWebhookRetryWait) * time.Millisecond
+	}
+	maxWait := time.Duration(DefaultWebhookMaxRetryWait) * time.Millisecond
+	for ; retry > 1 && wait < maxWait; retry-- {
+		wait *= 2
+	}
+	if wait > maxWait {
+		return maxWait
+	}
+	return wait
+}
+
+func (webhook *Webhook) GetTimeout() time.Duration {
+	if webhook.Timeout <= 0 {
+		return time.Duration(DefaultWebhookTimeout) * time.Second
+	}
+	return time.Duration(webhook.Timeout) * time.Second
+}
+
+const TLSClientAuthNone string = "none"
+const TLSClientAuthRequest string = "request"
+const TLSClientAuthRequire string = "require"
+
+const ListenSocketAuthToken string = "token"
+const ListenSocketAuthNone string = "none"
+
+const RoleReader string = "reader"
+const RoleOperator string = "operator"
+const RoleAdmin string = "admin"
+
+// Token is a REST API bearer token; Hash is the hex encoded SHA-256 of the token.
+// CommonName lets a verified TLS client certificate authenticate as this token.
+// Applications restricts the token to application names matching any of the
+// glob patterns; an empty list allows all applications.
+type Token struct {
+	Name         string
+	Hash         string
+	CommonName   string
+	Role         string
+	Applications []string
+}
+
+// GetRole treats tokens without a role as admin for compatibility and
+// tokens with an unknown role as read-only.
+func (token *Token) GetRole() string {
+	switch token.Role {
+	case "":
+		return RoleAdmin
+	case RoleReader, RoleOperator, RoleAdmin:
+		return token.Role
+	default:
+		return RoleReader
+	}
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
 
 type Configuration struct {
-	LogPath         string
-	LogLevel        string
-	LogMaxSize      int
-	LogMaxBackups   int
-	LogMaxAge       int
-	LogLocalTime    bool
-	StdLinesCount   int
-	ShutdownTimeout int
-	ListenPort      int
-	DateLayout      string
-	DatePrefix      string
-	DateSuffix      string
-	PidPath         string
-	PidFileName     string
+	LogPath            string
+	LogLevel           string
+	LogMaxSize         int
+	LogMaxBackups      int
+	LogMaxAge          int
+	LogLocalTime       bool
+	StdLinesCount      int
+	StdBytesCount      int
+	ShutdownTimeout    int
+	ListenPort         int
+	ListenAddress      string
+	ListenSocket       string
+	ListenSocketMode   string
+	ListenSocketUser   string
+	ListenSocketGroup  string
+	ListenSocketAuth   string
+	ListenSocketRole   string
+	DateLayout         string
+	DatePrefix         string
+	DateSuffix         string
+	PidPath            string
+	PidFileName        string
+	MirrorOutput       string
+	MirrorColor        bool
+	Sinks              []Sink
+	SearchMaxResults   int
+	SearchTimeout      int
+	Tokens             []Token
+	TokenFile          string
+	DisableAuth        bool
+	PublicVersion      bool
+	PublicHealth       bool
+	TLSCertFile        string
+	TLSKeyFile         string
+	TLSClientCAFile    string
+	TLSClientAuth      string
+	DisableGetActions  bool
+	WebSocketOrigins   []string
+	OperationRetention int
+	OperationTimeout   int
+	EventReplaySize    int
+	CrashLoopCount     int
+	CrashLoopWindow    int
+	Webhooks           []Webhook
+	WebhookDeadLetter  string
+	AuditLog           string
+	DisableAuditLog    bool
+	EnableExec         bool
+	ExecTimeout        int
+	ExecMaxOutput      int
 }
 
 func (config *Configuration) GetLogPath() string {
@@ -67,22 +351,250 @@ func (config *Configuration) GetLogLevel() logrus.Level {
 	}
 }
 
-func (config *Configuration) GetMaxStdLines() int {
+func (config *Configuration) GetMaxStdLines(appMaxLines int) int {
+	if appMaxLines > 0 {
+		return appMaxLines
+	}
+	if config.StdLinesCount <= 0 {
+		return DefaultStdLinesCount
+	}
 	return config.StdLinesCount
 }
 
+func (config *Configuration) GetMaxStdBytes(appMaxBytes int) int {
+	if appMaxBytes > 0 {
+		return appMaxBytes
+	}
+	if config.StdBytesCount <= 0 {
+		return DefaultStdBytesCount
+	}
+	return config.StdBytesCount
+}
+
+func (config *Configuration) GetDateLayout() string {
+	if config.DateLayout == "" {
+		return DefaultStdDateLayout
+	}
+	return config.DateLayout
+}
+
 func (config *Configuration) GetShutdownTimeout() int {
 	return config.ShutdownTimeout
 }
 
+// GetListenPort returns 0 when TCP is disabled, which is only allowed
+// together with a unix socket.
 func (config *Configuration) GetListenPort() int {
+	if config.ListenPort <= 0 {
+		if config.ListenSocket != "" {
+			return 0
+		}
+		return DefaultListenPort
+	}
 	return config.ListenPort
 }
 
+func (config *Configuration) GetListenSocketMode() os.FileMode {
+	mode, err := strconv.ParseUint(config.ListenSocketMode, 8, 32)
+	if err != nil || config.ListenSocketMode == "" {
+		return DefaultListenSocketMode
+	}
+	return os.FileMode(mode)
+}
+
+// GetListenSocketAuth returns none when requests over the unix socket are
+// trusted, its file permissions being the access control, and token
+// otherwise.
+func (config *Configuration) GetListenSocketAuth() string {
+	if config.ListenSocketAuth == ListenSocketAuthNone {
+		return ListenSocketAuthNone
+	}
+	return ListenSocketAuthToken
+}
+
+// GetListenSocketRole is the role of trusted unix socket requests, admin
+// unless another valid role is configured.
+func (config *Configuration) GetListenSocketRole() string {
+	switch config.ListenSocketRole {
+	case RoleReader, RoleOperator:
+		return config.ListenSocketRole
+	}
+	return RoleAdmin
+}
+
+func (config *Configuration) GetSearchMaxResults() int {
+	if config.SearchMaxResults <= 0 {
+		return DefaultSearchMaxResults
+	}
+	return config.SearchMaxResults
+}
+
+func (config *Configuration) GetSearchTimeout() time.Duration {
+	if config.SearchTimeout <= 0 {
+		return time.Duration(DefaultSearchTimeout) * time.Second
+	}
+	return time.Duration(config.SearchTimeout) * time.Second
+}
+
+func (config *Configuration) GetOperationRetention() time.Duration {
+	if config.OperationRetention <= 0 {
+		return time.Duration(DefaultOperationRetention) * time.Second
+	}
+	return time.Duration(config.OperationRetention) * time.Second
+}
+
+func (config *Configuration) GetOperationTimeout() time.Duration {
+	if config.OperationTimeout <= 0 {
+		return time.Duration(DefaultOperationTimeout) * time.Second
+	}
+	return time.Duration(config.OperationTimeout) * time.Second
+}
+
+func (config *Configuration) GetEventReplaySize() int {
+	if config.EventReplaySize <= 0 {
+		return DefaultEventReplaySize
+	}
+	return config.EventReplaySize
+}
+
+func (config *Configuration) GetCrashLoopCount() int {
+	if config.CrashLoopCount <= 0 {
+		return DefaultCrashLoopCount
+	}
+	return config.CrashLoopCount
+}
+
+func (config *Configuration) GetCrashLoopWindow() time.Duration {
+	if config.CrashLoopWindow <= 0 {
+		return time.Duration(DefaultCrashLoopWindow) * time.Second
+	}
+	return time.Duration(config.CrashLoopWindow) * time.Second
+}
+
+// GetExecTimeout returns how long a command run in the context of an
+// application may take at most.
+func (config *Configuration) GetExecTimeout() time.Duration {
+	if config.ExecTimeout <= 0 {
+		return time.Duration(DefaultExecTimeout) * time.Second
+	}
+	return time.Duration(config.ExecTimeout) * time.Second
+}
+
+// GetExecMaxOutput returns how many bytes of stdout and of stderr of such a
+// command are kept.
+func (config *Configuration) GetExecMaxOutput() int {
+	if config.ExecMaxOutput <= 0 {
+		return DefaultExecMaxOutput
+	}
+	return config.ExecMaxOutput
+}
+
+// GetWebhookDeadLetter returns the file which keeps webhook payloads that
+// could not be delivered, next to the exorsus log by default.
+func (config *Configuration) GetWebhookDeadLetter() string {
+	if config.WebhookDeadLetter == "" {
+		return path.Join(path.Dir(config.LogPath), DefaultWebhookDeadLetterFileName)
+	}
+	return config.WebhookDeadLetter
+}
+
+// GetAuditLog returns the file which records mutating REST requests, next
+// to the exorsus log by default.
+func (config *Configuration) GetAuditLog() string {
+	if config.AuditLog == "" {
+		return path.Join(path.Dir(config.LogPath), DefaultAuditLogFileName)
+	}
+	return config.AuditLog
+}
+
+// GetTokens returns tokens from the configuration together with the ones
+// from TokenFile, a JSON array of {"Name": ..., "Hash": ...} objects.
+func (config *Configuration) GetTokens() ([]Token, error) {
+	tokens := append([]Token{}, config.Tokens...)
+	if config.TokenFile == "" {
+		return tokens, nil
+	}
+	buf, err := ioutil.ReadFile(config.TokenFile)
+	if err != nil {
+		return tokens, err
+	}
+	var fileTokens []Token
+	err = json.Unmarshal(buf, &fileTokens)
+	if err != nil {
+		return tokens, err
+	}
+	return append(tokens, fileTokens...), nil
+}
+
+// InitTokenFile points TokenFile at tokens.json in the configuration directory
+// when no token is configured. The file is created with a generated admin
+// token when it does not exist yet; that token is returned, as only its hash
+// is stored, and "" otherwise.
+func (config *Configuration) InitTokenFile(configDir string) (string, error) {
+	if config.DisableAuth || len(config.Tokens) > 0 || config.TokenFile != "" {
+		return "", nil
+	}
+	config.TokenFile = path.Join(configDir, DefaultTokenFileName)
+	if _, err := os.Stat(config.TokenFile); err == nil {
+		return "", nil
+	}
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(random)
+	buf, err := json.MarshalIndent([]Token{{Name: "admin", Hash: HashToken(token), Role: RoleAdmin}}, "", "    ")
+	if err != nil {
+		return "", err
+	}
+	file, err := os.OpenFile(config.TokenFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(buf)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (config *Configuration) TLSEnabled() bool {
+	return config.TLSCertFile != "" && config.TLSKeyFile != ""
+}
+
+// GetTLSClientAuth defaults to requiring client certificates when a CA bundle is configured.
+func (config *Configuration) GetTLSClientAuth() string {
+	switch config.TLSClientAuth {
+	case TLSClientAuthNone, TLSClientAuthRequest, TLSClientAuthRequire:
+		return config.TLSClientAuth
+	}
+	if config.TLSClientCAFile != "" {
+		return TLSClientAuthRequire
+	}
+	return TLSClientAuthNone
+}
+
+func (config *Configuration) GetMirrorOutput(appMode string) string {
+	mode := config.MirrorOutput
+	if appMode != "" {
+		mode = appMode
+	}
+	switch mode {
+	case MirrorPrefixed, MirrorRaw:
+		return mode
+	default:
+		return MirrorOff
+	}
+}
+
 func (config *Configuration) applyDefaults() {
 	config.LogPath = DefaultLogPath
 	config.LogLevel = DefaultLogLevel
 	config.StdLinesCount = DefaultStdLinesCount
+	config.StdBytesCount = DefaultStdBytesCount
 	config.ShutdownTimeout = DefaultShutdownTimeout
 	config.ListenPort = DefaultListenPort
 	config.DateLayout = DefaultStdDateLayout
@@ -94,6 +606,17 @@ func (config *Configuration) applyDefaults() {
 	config.LogLocalTime = DefaultLogLocalTime
 	config.PidPath = DefaultPidPath
 	config.PidFileName = DefaultPidFileName
+	config.MirrorOutput = DefaultMirrorOutput
+	config.MirrorColor = DefaultMirrorColor
+	config.SearchMaxResults = DefaultSearchMaxResults
+	config.SearchTimeout = DefaultSearchTimeout
+	config.OperationRetention = DefaultOperationRetention
+	config.OperationTimeout = DefaultOperationTimeout
+	config.EventReplaySize = DefaultEventReplaySize
+	config.CrashLoopCount = DefaultCrashLoopCount
+	config.CrashLoopWindow = DefaultCrashLoopWindow
+	config.ExecTimeout = DefaultExecTimeout
+	config.ExecMaxOutput = DefaultExecMaxOutput
 	if _, err := os.Stat(DefaultConfigPath); os.IsNotExist(err) {
 		err := os.Mkdir(DefaultConfigPath, 0755)
 		if err != nil {
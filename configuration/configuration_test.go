@@ -0,0 +1,66 @@
+package configuration
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestInitTokenFile(t *testing.T) {
+	dir := t.TempDir()
+	config := &Configuration{}
+	token, err := config.InitTokenFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token == "" || config.TokenFile != path.Join(dir, DefaultTokenFileName) {
+		t.Fatalf("token %q, file %q, want a token in %s", token, config.TokenFile, DefaultTokenFileName)
+	}
+	info, err := os.Stat(config.TokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("token file mode = %v, want 0600", info.Mode().Perm())
+	}
+	tokens, err := config.GetTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].Hash != HashToken(token) || tokens[0].GetRole() != RoleAdmin {
+		t.Errorf("tokens = %+v, want the hash of the generated admin token", tokens)
+	}
+	raw, _ := ioutil.ReadFile(config.TokenFile)
+	if !json.Valid(raw) || strings.Contains(string(raw), token) {
+		t.Errorf("token file = %s, want JSON without the plain token", raw)
+	}
+
+	// The file of a previous start is used as it is.
+	again := &Configuration{}
+	if token, err := again.InitTokenFile(dir); err != nil || token != "" || again.TokenFile != config.TokenFile {
+		t.Errorf("second start: token %q, file %q, error %v", token, again.TokenFile, err)
+	}
+
+	for _, configured := range []*Configuration{
+		{DisableAuth: true},
+		{Tokens: []Token{{Name: "root", Hash: HashToken("x")}}},
+		{TokenFile: "/etc/exorsus/tokens.json"},
+	} {
+		tokenFile := configured.TokenFile
+		if token, err := configured.InitTokenFile(t.TempDir()); err != nil || token != "" || configured.TokenFile != tokenFile {
+			t.Errorf("%+v: token %q, file %q, error %v", configured, token, configured.TokenFile, err)
+		}
+	}
+}
+
+func TestListenSocketRole(t *testing.T) {
+	for role, want := range map[string]string{"": RoleAdmin, "reader": RoleReader, "root": RoleAdmin} {
+		config := &Configuration{ListenSocketRole: role}
+		if got := config.GetListenSocketRole(); got != want {
+			t.Errorf("GetListenSocketRole(%q) = %s, want %s", role, got, want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package events
+
+import (
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const TypeStarting string = "starting"
+const TypeStarted string = "started"
+const TypeStopping string = "stopping"
+const TypeExited string = "exited"
+const TypeKilled string = "killed"
+const TypeFailed string = "failed"
+const TypeSignaled string = "signaled"
+const TypeCrashed string = "crashed"
+const TypeCrashLoop string = "crash_loop"
+const TypeHealthChanged string = "health_changed"
+const TypeConfigChanged string = "config_changed"
+
+const subscriptionBuffer int = 256
+
+type Event struct {
+	ID          uint64    `json:"id"`
+	Time        time.Time `json:"time"`
+	Type        string    `json:"type"`
+	Application string    `json:"application"`
+	State       string    `json:"state,omitempty"`
+	Pid         int       `json:"pid,omitempty"`
+	Code        int       `json:"code"`
+	Error       string    `json:"error,omitempty"`
+	Message     string    `json:"message,omitempty"`
+}
+
+// Filter selects events by application (path.Match globs) and type; empty
+// lists match everything.
+type Filter struct {
+	Applications []string
+	Types        []string
+}
+
+func (filter Filter) Match(event Event) bool {
+	if len(filter.Types) > 0 {
+		found := false
+		for _, eventType := range filter.Types {
+			if eventType == event.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(filter.Applications) == 0 {
+		return true
+	}
+	for _, pattern := range filter.Applications {
+		if matched, err := path.Match(pattern, event.Application); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription receives matching events on C until it is cancelled. A slow
+// subscriber misses events instead of blocking the publisher.
+type Subscription struct {
+	C       <-chan Event
+	channel chan Event
+	filter  Filter
+	dropped uint64
+}
+
+func (subscription *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&subscription.dropped)
+}
+
+// Bus fans events out to subscribers and keeps the latest ones for replay.
+type Bus struct {
+	subscribers map[*Subscription]struct{}
+	replay      []Event
+	next        int
+	size        int
+	lastID      uint64
+	lock        sync.Mutex
+}
+
+// Publish stamps the event with an ID and time and delivers it. It is safe
+// to call on a nil bus.
+func (bus *Bus) Publish(event Event) {
+	if bus == nil {
+		return
+	}
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+	bus.lastID++
+	event.ID = bus.lastID
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if len(bus.replay) < bus.size {
+		bus.replay = append(bus.replay, event)
+	} else if bus.size > 0 {
+		bus.replay[bus.next] = event
+		bus.next = (bus.next + 1) % bus.size
+	}
+	for subscription := range bus.subscribers {
+		if !subscription.filter.Match(event) {
+			continue
+		}
+		select {
+		case subscription.channel <- event:
+		default:
+			atomic.AddUint64(&subscription.dropped, 1)
+		}
+	}
+}
+
+// Subscribe registers a subscription and returns the buffered events newer
+// than since which match the filter.
+func (bus *Bus) Subscribe(filter Filter, since uint64) (*Subscription, []Event) {
+	channel := make(chan Event, subscriptionBuffer)
+	subscription := &Subscription{C: channel, channel: channel, filter: filter}
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+	bus.subscribers[subscription] = struct{}{}
+	var replayed []Event
+	for idx := range bus.replay {
+		event := bus.replay[(bus.next+idx)%len(bus.replay)]
+		if event.ID > since && filter.Match(event) {
+			replayed = append(replayed, event)
+		}
+	}
+	return subscription, replayed
+}
+
+func (bus *Bus) Unsubscribe(subscription *Subscription) {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+	delete(bus.subscribers, subscription)
+}
+
+func NewBus(size int) *Bus {
+	return &Bus{subscribers: make(map[*Subscription]struct{}), size: size}
+}
@@ -0,0 +1,278 @@
+package forwarding
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/vvhq/exorsus/configuration"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const LogSource string = "exorsus"
+const StreamLog string = "log"
+
+// Entry is a single line of either the exorsus own log or application output.
+type Entry struct {
+	Time    time.Time
+	Level   logrus.Level
+	Source  string
+	Stream  string
+	Message string
+	Fields  map[string]interface{}
+}
+
+func (entry *Entry) isLog() bool {
+	return entry.Stream == StreamLog
+}
+
+// Text returns the message followed by its fields in logfmt order.
+func (entry *Entry) Text() string {
+	if len(entry.Fields) == 0 {
+		return entry.Message
+	}
+	keys := make([]string, 0, len(entry.Fields))
+	for key := range entry.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var builder strings.Builder
+	builder.WriteString(entry.Message)
+	for _, key := range keys {
+		builder.WriteString(fmt.Sprintf(" %s=%q", key, fmt.Sprint(entry.Fields[key])))
+	}
+	return builder.String()
+}
+
+type Sink interface {
+	Send(entries []Entry) error
+	Close() error
+}
+
+// permanentError marks a batch which must not be retried, e.g. rejected by the receiver.
+type permanentError struct {
+	err error
+}
+
+func (permanent *permanentError) Error() string {
+	return permanent.err.Error()
+}
+
+type queue struct {
+	config  configuration.Sink
+	sink    Sink
+	entries chan Entry
+	dropped uint64
+	sent    uint64
+	done    chan struct{}
+	logger  *logrus.Logger
+}
+
+func (queue *queue) push(entry Entry) {
+	select {
+	case queue.entries <- entry:
+	default:
+		atomic.AddUint64(&queue.dropped, 1)
+	}
+}
+
+func (queue *queue) run() {
+	defer close(queue.done)
+	batchSize := queue.config.GetBatchSize()
+	ticker := time.NewTicker(queue.config.GetBatchWait())
+	defer ticker.Stop()
+	batch := make([]Entry, 0, batchSize)
+	for {
+		select {
+		case entry, ok := <-queue.entries:
+			if !ok {
+				queue.flush(batch)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= batchSize {
+				queue.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				queue.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+func (queue *queue) flush(batch []Entry) {
+	if len(batch) == 0 {
+		return
+	}
+	retries := queue.config.GetRetries()
+	retryWait := queue.config.GetRetryWait()
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(retryWait * time.Duration(attempt))
+		}
+		err = queue.sink.Send(batch)
+		if err == nil {
+			atomic.AddUint64(&queue.sent, uint64(len(batch)))
+			return
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			break
+		}
+	}
+	atomic.AddUint64(&queue.dropped, uint64(len(batch)))
+	queue.logger.
+		WithField("source", "forwarding").
+		WithField("sink", queue.config.Name).
+		WithField("entries", len(batch)).
+		WithField("error", err.Error()).
+		Error("Can not forward log entries")
+}
+
+type SinkStatus struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Sent    uint64 `json:"sent"`
+	Dropped uint64 `json:"dropped"`
+}
+
+// Forwarder fans log entries out to all configured sinks. Pushing never
+// blocks: when a sink buffer is full the entry is dropped and counted.
+type Forwarder struct {
+	queues []*queue
+	closed int32
+	lock   sync.RWMutex
+	logger *logrus.Logger
+}
+
+func (forwarder *Forwarder) Push(entry Entry) {
+	if forwarder == nil || len(forwarder.queues) == 0 {
+		return
+	}
+	forwarder.lock.RLock()
+	defer forwarder.lock.RUnlock()
+	if atomic.LoadInt32(&forwarder.closed) == 1 {
+		return
+	}
+	for _, queue := range forwarder.queues {
+		include := queue.config.GetInclude()
+		if include == configuration.SinkIncludeLog && !entry.isLog() {
+			continue
+		}
+		if include == configuration.SinkIncludeOutput && entry.isLog() {
+			continue
+		}
+		queue.push(entry)
+	}
+}
+
+func (forwarder *Forwarder) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook for the exorsus own log.
+func (forwarder *Forwarder) Fire(entry *logrus.Entry) error {
+	if source, ok := entry.Data["source"]; ok && source == "forwarding" {
+		return nil
+	}
+	fields := make(map[string]interface{}, len(entry.Data))
+	for key, value := range entry.Data {
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		fields[key] = value
+	}
+	forwarder.Push(Entry{Time: entry.Time, Level: entry.Level, Source: LogSource, Stream: StreamLog, Message: entry.Message, Fields: fields})
+	return nil
+}
+
+func (forwarder *Forwarder) Status() []SinkStatus {
+	var sinkStatus []SinkStatus
+	if forwarder == nil {
+		return sinkStatus
+	}
+	for _, queue := range forwarder.queues {
+		sinkStatus = append(sinkStatus, SinkStatus{
+			Name:    queue.config.Name,
+			Type:    queue.config.Type,
+			Sent:    atomic.LoadUint64(&queue.sent),
+			Dropped: atomic.LoadUint64(&queue.dropped)})
+	}
+	return sinkStatus
+}
+
+// Close flushes buffered entries and closes all sinks.
+func (forwarder *Forwarder) Close() {
+	if forwarder == nil {
+		return
+	}
+	forwarder.lock.Lock()
+	if !atomic.CompareAndSwapInt32(&forwarder.closed, 0, 1) {
+		forwarder.lock.Unlock()
+		return
+	}
+	for _, queue := range forwarder.queues {
+		close(queue.entries)
+	}
+	forwarder.lock.Unlock()
+	for _, queue := range forwarder.queues {
+		<-queue.done
+		err := queue.sink.Close()
+		if err != nil {
+			forwarder.logger.
+				WithField("source", "forwarding").
+				WithField("sink", queue.config.Name).
+				WithField("error", err.Error()).
+				Error("Can not close sink")
+		}
+	}
+}
+
+func newSink(config configuration.Sink, hostName string) (Sink, error) {
+	switch config.Type {
+	case configuration.SinkSyslog:
+		return newSyslogSink(config, hostName)
+	case configuration.SinkGELF:
+		return newGELFSink(config, hostName)
+	case configuration.SinkLoki:
+		return newLokiSink(config, hostName)
+	default:
+		return nil, fmt.Errorf("unknown sink type '%s'", config.Type)
+	}
+}
+
+func New(sinks []configuration.Sink, logger *logrus.Logger) *Forwarder {
+	forwarder := &Forwarder{logger: logger}
+	hostName, err := os.Hostname()
+	if err != nil {
+		hostName = "-"
+	}
+	for _, sinkConfig := range sinks {
+		sink, err := newSink(sinkConfig, hostName)
+		if err != nil {
+			logger.
+				WithField("source", "forwarding").
+				WithField("sink", sinkConfig.Name).
+				WithField("error", err.Error()).
+				Error("Skip sink due error")
+			continue
+		}
+		queue := &queue{
+			config:  sinkConfig,
+			sink:    sink,
+			entries: make(chan Entry, sinkConfig.GetBufferSize()),
+			done:    make(chan struct{}),
+			logger:  logger}
+		forwarder.queues = append(forwarder.queues, queue)
+		go queue.run()
+	}
+	return forwarder
+}
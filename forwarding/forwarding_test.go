@@ -0,0 +1,81 @@
+package forwarding
+
+import (
+	"errors"
+	"github.com/sirupsen/logrus"
+	"github.com/vvhq/exorsus/configuration"
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+type recordingSink struct {
+	lock    sync.Mutex
+	entries []Entry
+	fail    error
+}
+
+func (sink *recordingSink) Send(entries []Entry) error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	if sink.fail != nil {
+		return sink.fail
+	}
+	sink.entries = append(sink.entries, entries...)
+	return nil
+}
+
+func (sink *recordingSink) Close() error {
+	return nil
+}
+
+func testForwarder(sink Sink, config configuration.Sink) *Forwarder {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	sinkQueue := &queue{
+		config:  config,
+		sink:    sink,
+		entries: make(chan Entry, config.GetBufferSize()),
+		done:    make(chan struct{}),
+		logger:  logger}
+	return &Forwarder{queues: []*queue{sinkQueue}, logger: logger}
+}
+
+func TestForwarderIncludeAndStatus(t *testing.T) {
+	sink := &recordingSink{}
+	forwarder := testForwarder(sink, configuration.Sink{Name: "out", Type: configuration.SinkLoki, Include: configuration.SinkIncludeOutput})
+	go forwarder.queues[0].run()
+	forwarder.Push(Entry{Source: "web", Stream: "stdout", Message: "kept"})
+	forwarder.Push(Entry{Source: LogSource, Stream: StreamLog, Message: "skipped"})
+	forwarder.Close()
+	if len(sink.entries) != 1 || sink.entries[0].Message != "kept" {
+		t.Fatalf("sink got %+v, want only the output entry", sink.entries)
+	}
+	status := forwarder.Status()
+	if len(status) != 1 || status[0].Name != "out" || status[0].Type != configuration.SinkLoki || status[0].Sent != 1 || status[0].Dropped != 0 {
+		t.Errorf("Status() = %+v", status)
+	}
+}
+
+func TestForwarderDropsWhenFull(t *testing.T) {
+	forwarder := testForwarder(&recordingSink{}, configuration.Sink{Name: "full", BufferSize: 2})
+	for idx := 0; idx < 5; idx++ {
+		forwarder.Push(Entry{Source: "web", Stream: "stdout", Message: "m"})
+	}
+	if dropped := forwarder.Status()[0].Dropped; dropped != 3 {
+		t.Errorf("dropped = %d, want 3", dropped)
+	}
+}
+
+func TestForwarderDropsFailedBatch(t *testing.T) {
+	sink := &recordingSink{fail: &permanentError{err: errors.New("rejected")}}
+	forwarder := testForwarder(sink, configuration.Sink{Name: "bad", Retries: 3})
+	go forwarder.queues[0].run()
+	forwarder.Push(Entry{Source: "web", Stream: "stdout", Message: "m"})
+	forwarder.Push(Entry{Source: "web", Stream: "stdout", Message: "m"})
+	forwarder.Close()
+	status := forwarder.Status()[0]
+	if status.Sent != 0 || status.Dropped != 2 {
+		t.Errorf("Status() = %+v, want 2 dropped", status)
+	}
+}
@@ -0,0 +1,143 @@
+package forwarding
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vvhq/exorsus/configuration"
+	"net"
+	"regexp"
+	"time"
+)
+
+const gelfVersion string = "1.1"
+const gelfChunkSize int = 1420
+const gelfChunkHeaderSize int = 12
+const gelfMaxChunks int = 128
+
+var errGELFTooLarge = errors.New("GELF message too large")
+
+var gelfFieldName = regexp.MustCompile(`[^\w\.\-]`)
+
+type gelfSink struct {
+	address  string
+	hostName string
+	timeout  time.Duration
+	conn     net.Conn
+}
+
+func (sink *gelfSink) Send(entries []Entry) error {
+	if sink.conn == nil {
+		conn, err := net.DialTimeout("udp", sink.address, sink.timeout)
+		if err != nil {
+			return err
+		}
+		sink.conn = conn
+	}
+	for _, entry := range entries {
+		message, err := json.Marshal(sink.format(entry))
+		if err != nil {
+			continue
+		}
+		err = sink.write(message)
+		if err == errGELFTooLarge {
+			continue
+		}
+		if err != nil {
+			_ = sink.conn.Close()
+			sink.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (sink *gelfSink) format(entry Entry) map[string]interface{} {
+	message := map[string]interface{}{
+		"version":       gelfVersion,
+		"host":          sink.hostName,
+		"short_message": entry.Message,
+		"timestamp":     float64(entry.Time.UnixNano()) / float64(time.Second),
+		"level":         severity(entry.Level),
+		"_application":  entry.Source,
+		"_stream":       entry.Stream,
+	}
+	if entry.Message == "" {
+		message["short_message"] = "-"
+	}
+	for key, value := range entry.Fields {
+		name := "_" + gelfFieldName.ReplaceAllString(key, "_")
+		if name == "_id" {
+			name = "_field_id"
+		}
+		if _, ok := message[name]; ok {
+			continue
+		}
+		switch value.(type) {
+		case string, bool, int, int32, int64, uint, uint32, uint64, float32, float64:
+			message[name] = value
+		default:
+			message[name] = fmt.Sprint(value)
+		}
+	}
+	return message
+}
+
+func (sink *gelfSink) write(message []byte) error {
+	err := sink.conn.SetWriteDeadline(time.Now().Add(sink.timeout))
+	if err != nil {
+		return err
+	}
+	if len(message) <= gelfChunkSize {
+		_, err = sink.conn.Write(message)
+		return err
+	}
+	payloadSize := gelfChunkSize - gelfChunkHeaderSize
+	count := (len(message) + payloadSize - 1) / payloadSize
+	if count > gelfMaxChunks {
+		return errGELFTooLarge
+	}
+	messageId := make([]byte, 8)
+	_, err = rand.Read(messageId)
+	if err != nil {
+		return err
+	}
+	chunk := make([]byte, 0, gelfChunkSize)
+	for sequence := 0; sequence < count; sequence++ {
+		start := sequence * payloadSize
+		end := start + payloadSize
+		if end > len(message) {
+			end = len(message)
+		}
+		chunk = chunk[:0]
+		chunk = append(chunk, 0x1e, 0x0f)
+		chunk = append(chunk, messageId...)
+		chunk = append(chunk, byte(sequence), byte(count))
+		chunk = append(chunk, message[start:end]...)
+		_, err = sink.conn.Write(chunk)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sink *gelfSink) Close() error {
+	if sink.conn == nil {
+		return nil
+	}
+	err := sink.conn.Close()
+	sink.conn = nil
+	return err
+}
+
+func newGELFSink(config configuration.Sink, hostName string) (*gelfSink, error) {
+	if config.Network != "" && config.Network != "udp" {
+		return nil, fmt.Errorf("unsupported GELF network '%s'", config.Network)
+	}
+	if config.Address == "" {
+		return nil, fmt.Errorf("GELF address required")
+	}
+	return &gelfSink{address: config.Address, hostName: hostName, timeout: config.GetTimeout()}, nil
+}
@@ -0,0 +1,127 @@
+package forwarding
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"github.com/vvhq/exorsus/configuration"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func gelfListener(t *testing.T) (net.PacketConn, *gelfSink) {
+	t.Helper()
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink, err := newGELFSink(configuration.Sink{Address: listener.LocalAddr().String()}, "host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return listener, sink
+}
+
+func readDatagram(t *testing.T, listener net.PacketConn) []byte {
+	t.Helper()
+	buffer := make([]byte, 65536)
+	_ = listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+	count, _, err := listener.ReadFrom(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buffer[:count]
+}
+
+func TestGELFMessage(t *testing.T) {
+	listener, sink := gelfListener(t)
+	defer listener.Close()
+	defer sink.Close()
+	entry := Entry{Time: testTime, Level: logrus.WarnLevel, Source: "web", Stream: "stderr", Message: "slow",
+		Fields: map[string]interface{}{"id": "x", "took ms": 12, "stream": "ignored"}}
+	if err := sink.Send([]Entry{entry}); err != nil {
+		t.Fatal(err)
+	}
+	message := map[string]interface{}{}
+	if err := json.Unmarshal(readDatagram(t, listener), &message); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"version":       "1.1",
+		"host":          "host",
+		"short_message": "slow",
+		"timestamp":     float64(testTime.Unix()),
+		"level":         float64(4),
+		"_application":  "web",
+		"_stream":       "stderr",
+		"_field_id":     "x",
+		"_took_ms":      float64(12),
+	}
+	for key, value := range want {
+		if message[key] != value {
+			t.Errorf("%s = %v, want %v", key, message[key], value)
+		}
+	}
+	if len(message) != len(want) {
+		t.Errorf("message has %d fields, want %d: %v", len(message), len(want), message)
+	}
+}
+
+func TestGELFChunking(t *testing.T) {
+	listener, sink := gelfListener(t)
+	defer listener.Close()
+	defer sink.Close()
+	entry := Entry{Time: testTime, Level: logrus.InfoLevel, Source: "web", Stream: "stdout", Message: strings.Repeat("x", 5000)}
+	if err := sink.Send([]Entry{entry}); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := json.Marshal(sink.format(entry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloadSize := gelfChunkSize - gelfChunkHeaderSize
+	count := (len(expected) + payloadSize - 1) / payloadSize
+	var id []byte
+	var assembled []byte
+	for sequence := 0; sequence < count; sequence++ {
+		chunk := readDatagram(t, listener)
+		if len(chunk) > gelfChunkSize {
+			t.Fatalf("chunk %d has %d bytes, more than %d", sequence, len(chunk), gelfChunkSize)
+		}
+		if chunk[0] != 0x1e || chunk[1] != 0x0f {
+			t.Fatalf("chunk %d has magic %x", sequence, chunk[:2])
+		}
+		if id == nil {
+			id = append(id, chunk[2:10]...)
+		} else if !bytes.Equal(id, chunk[2:10]) {
+			t.Fatalf("chunk %d has message id %x, want %x", sequence, chunk[2:10], id)
+		}
+		if int(chunk[10]) != sequence || int(chunk[11]) != count {
+			t.Fatalf("chunk %d has sequence %d of %d, want %d of %d", sequence, chunk[10], chunk[11], sequence, count)
+		}
+		assembled = append(assembled, chunk[gelfChunkHeaderSize:]...)
+	}
+	if !bytes.Equal(assembled, expected) {
+		t.Errorf("assembled message differs from the sent one")
+	}
+}
+
+func TestGELFTooLarge(t *testing.T) {
+	listener, sink := gelfListener(t)
+	defer listener.Close()
+	defer sink.Close()
+	huge := Entry{Time: testTime, Level: logrus.InfoLevel, Source: "web", Message: strings.Repeat("x", gelfChunkSize*gelfMaxChunks)}
+	small := Entry{Time: testTime, Level: logrus.InfoLevel, Source: "web", Message: "after"}
+	if err := sink.Send([]Entry{huge, small}); err != nil {
+		t.Fatal(err)
+	}
+	message := map[string]interface{}{}
+	if err := json.Unmarshal(readDatagram(t, listener), &message); err != nil {
+		t.Fatal(err)
+	}
+	if message["short_message"] != "after" {
+		t.Errorf("short_message = %v, want the message after the skipped one", message["short_message"])
+	}
+}
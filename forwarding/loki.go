@@ -0,0 +1,124 @@
+package forwarding
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/vvhq/exorsus/configuration"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const lokiPushPath string = "/loki/api/v1/push"
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type lokiPush struct {
+	Streams []*lokiStream `json:"streams"`
+}
+
+type lokiSink struct {
+	url      string
+	tenant   string
+	labels   map[string]string
+	hostName string
+	client   *http.Client
+}
+
+func (sink *lokiSink) Send(entries []Entry) error {
+	streams := make(map[string]*lokiStream)
+	push := lokiPush{}
+	for _, entry := range entries {
+		labels := sink.streamLabels(entry)
+		key := lokiStreamKey(labels)
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{Stream: labels}
+			streams[key] = stream
+			push.Streams = append(push.Streams, stream)
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(entry.Time.UnixNano(), 10), entry.Text()})
+	}
+	body, err := json.Marshal(push)
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	request, err := http.NewRequest(http.MethodPost, sink.url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if sink.tenant != "" {
+		request.Header.Set("X-Scope-OrgID", sink.tenant)
+	}
+	response, err := sink.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	responseBody, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("loki push failed: %s: %s", response.Status, strings.TrimSpace(string(responseBody)))
+	if response.StatusCode >= 400 && response.StatusCode < 500 && response.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err: err}
+	}
+	return err
+}
+
+func (sink *lokiSink) streamLabels(entry Entry) map[string]string {
+	labels := make(map[string]string, len(sink.labels)+4)
+	for name, value := range sink.labels {
+		labels[name] = value
+	}
+	labels["host"] = sink.hostName
+	labels["application"] = entry.Source
+	labels["stream"] = entry.Stream
+	labels["level"] = entry.Level.String()
+	return labels
+}
+
+func (sink *lokiSink) Close() error {
+	sink.client.CloseIdleConnections()
+	return nil
+}
+
+func lokiStreamKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var builder strings.Builder
+	for _, name := range names {
+		builder.WriteString(name)
+		builder.WriteString("=")
+		builder.WriteString(labels[name])
+		builder.WriteString(",")
+	}
+	return builder.String()
+}
+
+func newLokiSink(config configuration.Sink, hostName string) (*lokiSink, error) {
+	if config.Address == "" {
+		return nil, fmt.Errorf("loki address required")
+	}
+	url := strings.TrimRight(config.Address, "/")
+	if !strings.HasSuffix(url, lokiPushPath) {
+		url = url + lokiPushPath
+	}
+	return &lokiSink{
+		url:      url,
+		tenant:   config.Tenant,
+		labels:   config.Labels,
+		hostName: hostName,
+		client:   &http.Client{Timeout: config.GetTimeout()}}, nil
+}
@@ -0,0 +1,105 @@
+package forwarding
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"github.com/vvhq/exorsus/configuration"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestLokiPush(t *testing.T) {
+	var push lokiPush
+	var path, tenant, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		path = request.URL.Path
+		tenant = request.Header.Get("X-Scope-OrgID")
+		contentType = request.Header.Get("Content-Type")
+		if err := json.NewDecoder(request.Body).Decode(&push); err != nil {
+			t.Error(err)
+		}
+		responseWriter.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	sink, err := newLokiSink(configuration.Sink{Address: server.URL + "/", Tenant: "team", Labels: map[string]string{"env": "test"}}, "host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	entries := []Entry{
+		{Time: testTime, Level: logrus.InfoLevel, Source: "web", Stream: "stdout", Message: "one"},
+		{Time: testTime.Add(1), Level: logrus.InfoLevel, Source: "web", Stream: "stdout", Message: "two", Fields: map[string]interface{}{"k": "v"}},
+		{Time: testTime, Level: logrus.ErrorLevel, Source: "web", Stream: "stderr", Message: "three"},
+	}
+	if err := sink.Send(entries); err != nil {
+		t.Fatal(err)
+	}
+	if path != lokiPushPath {
+		t.Errorf("path = %q, want %q", path, lokiPushPath)
+	}
+	if tenant != "team" {
+		t.Errorf("tenant = %q, want %q", tenant, "team")
+	}
+	if contentType != "application/json" {
+		t.Errorf("content type = %q", contentType)
+	}
+	if len(push.Streams) != 2 {
+		t.Fatalf("got %d streams, want 2", len(push.Streams))
+	}
+	stdout := push.Streams[0]
+	wantLabels := map[string]string{"env": "test", "host": "host", "application": "web", "stream": "stdout", "level": "info"}
+	for name, value := range wantLabels {
+		if stdout.Stream[name] != value {
+			t.Errorf("label %s = %q, want %q", name, stdout.Stream[name], value)
+		}
+	}
+	wantValues := [][2]string{
+		{strconv.FormatInt(testTime.UnixNano(), 10), "one"},
+		{strconv.FormatInt(testTime.UnixNano()+1, 10), `two k="v"`},
+	}
+	if len(stdout.Values) != len(wantValues) {
+		t.Fatalf("got %d values, want %d", len(stdout.Values), len(wantValues))
+	}
+	for idx, value := range wantValues {
+		if stdout.Values[idx] != value {
+			t.Errorf("value %d = %v, want %v", idx, stdout.Values[idx], value)
+		}
+	}
+	if push.Streams[1].Stream["level"] != "error" || push.Streams[1].Values[0][1] != "three" {
+		t.Errorf("unexpected stderr stream %+v", push.Streams[1])
+	}
+}
+
+func TestLokiErrors(t *testing.T) {
+	tests := []struct {
+		status    int
+		permanent bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, false},
+	}
+	for _, test := range tests {
+		t.Run(http.StatusText(test.status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+				http.Error(responseWriter, "nope", test.status)
+			}))
+			defer server.Close()
+			sink, err := newLokiSink(configuration.Sink{Address: server.URL}, "host")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = sink.Send([]Entry{{Time: testTime, Source: "web", Message: "m"}})
+			if err == nil {
+				t.Fatal("Send succeeded, want error")
+			}
+			var permanent *permanentError
+			if errors.As(err, &permanent) != test.permanent {
+				t.Errorf("permanent = %v, want %v (%v)", !test.permanent, test.permanent, err)
+			}
+		})
+	}
+}
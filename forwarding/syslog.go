@@ -0,0 +1,170 @@
+package forwarding
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/vvhq/exorsus/configuration"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+const syslogVersion int = 1
+const syslogStructuredDataID string = "exorsus@32473"
+const syslogDefaultFacility int = 1
+
+// severity maps logrus levels to RFC5424 severities, which GELF reuses.
+func severity(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel:
+		return 0
+	case logrus.FatalLevel:
+		return 2
+	case logrus.ErrorLevel:
+		return 3
+	case logrus.WarnLevel:
+		return 4
+	case logrus.InfoLevel:
+		return 6
+	default:
+		return 7
+	}
+}
+
+type syslogSink struct {
+	network  string
+	address  string
+	facility int
+	hostName string
+	timeout  time.Duration
+	conn     net.Conn
+}
+
+func (sink *syslogSink) stream() bool {
+	return sink.network == "tcp" || sink.network == "tcp4" || sink.network == "tcp6" || sink.network == "unix"
+}
+
+func (sink *syslogSink) Send(entries []Entry) error {
+	if sink.conn == nil {
+		conn, err := net.DialTimeout(sink.network, sink.address, sink.timeout)
+		if err != nil {
+			return err
+		}
+		sink.conn = conn
+	}
+	for _, entry := range entries {
+		message := sink.format(entry)
+		if sink.stream() {
+			// RFC6587 octet counting framing
+			message = fmt.Sprintf("%d %s", len(message), message)
+		}
+		err := sink.conn.SetWriteDeadline(time.Now().Add(sink.timeout))
+		if err == nil {
+			_, err = sink.conn.Write([]byte(message))
+		}
+		if err != nil {
+			_ = sink.conn.Close()
+			sink.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (sink *syslogSink) format(entry Entry) string {
+	priority := sink.facility*8 + severity(entry.Level)
+	return fmt.Sprintf("<%d>%d %s %s %s - %s %s %s",
+		priority,
+		syslogVersion,
+		entry.Time.Format(time.RFC3339Nano),
+		syslogHeaderValue(sink.hostName, 255),
+		syslogHeaderValue(entry.Source, 48),
+		syslogHeaderValue(entry.Stream, 32),
+		syslogStructuredData(entry.Fields),
+		entry.Message)
+}
+
+func (sink *syslogSink) Close() error {
+	if sink.conn == nil {
+		return nil
+	}
+	err := sink.conn.Close()
+	sink.conn = nil
+	return err
+}
+
+func syslogHeaderValue(value string, max int) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, value)
+	if value == "" {
+		return "-"
+	}
+	if len(value) > max {
+		return value[:max]
+	}
+	return value
+}
+
+func syslogStructuredData(fields map[string]interface{}) string {
+	if len(fields) == 0 {
+		return "-"
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	escaper := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "]", "\\]")
+	var builder strings.Builder
+	builder.WriteString("[" + syslogStructuredDataID)
+	for _, key := range keys {
+		name := strings.Map(func(r rune) rune {
+			if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' || r == ' ' {
+				return -1
+			}
+			return r
+		}, key)
+		if name == "" {
+			continue
+		}
+		if len(name) > 32 {
+			name = name[:32]
+		}
+		builder.WriteString(fmt.Sprintf(" %s=\"%s\"", name, escaper.Replace(fmt.Sprint(fields[key]))))
+	}
+	builder.WriteString("]")
+	return builder.String()
+}
+
+func newSyslogSink(config configuration.Sink, hostName string) (*syslogSink, error) {
+	network := config.Network
+	if network == "" {
+		network = "udp"
+	}
+	switch network {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6", "unix", "unixgram":
+	default:
+		return nil, fmt.Errorf("unsupported syslog network '%s'", network)
+	}
+	if config.Address == "" {
+		return nil, fmt.Errorf("syslog address required")
+	}
+	facility := syslogDefaultFacility
+	if config.Facility != nil {
+		facility = *config.Facility
+	}
+	if facility < 0 || facility > 23 {
+		return nil, fmt.Errorf("syslog facility %d out of range 0-23", facility)
+	}
+	return &syslogSink{
+		network:  network,
+		address:  config.Address,
+		facility: facility,
+		hostName: hostName,
+		timeout:  config.GetTimeout()}, nil
+}
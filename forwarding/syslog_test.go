@@ -0,0 +1,171 @@
+package forwarding
+
+import (
+	"bufio"
+	"github.com/sirupsen/logrus"
+	"github.com/vvhq/exorsus/configuration"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testTime = time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+func facility(value int) *int {
+	return &value
+}
+
+func TestSyslogFormat(t *testing.T) {
+	sink, err := newSyslogSink(configuration.Sink{Address: "127.0.0.1:514", Facility: facility(16)}, "host one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		entry Entry
+		want  string
+	}{
+		{
+			name:  "plain",
+			entry: Entry{Time: testTime, Level: logrus.InfoLevel, Source: "web", Stream: "stdout", Message: "hello"},
+			want:  "<134>1 2024-05-06T07:08:09Z hostone web - stdout - hello",
+		},
+		{
+			name:  "error with fields",
+			entry: Entry{Time: testTime, Level: logrus.ErrorLevel, Source: "web", Stream: "stderr", Message: "boom", Fields: map[string]interface{}{"b": 2, "a": `x"]`}},
+			want:  `<131>1 2024-05-06T07:08:09Z hostone web - stderr [exorsus@32473 a="x\"\]" b="2"] boom`,
+		},
+		{
+			name:  "empty source",
+			entry: Entry{Time: testTime, Level: logrus.DebugLevel, Stream: StreamLog, Message: "m"},
+			want:  "<135>1 2024-05-06T07:08:09Z hostone - - log - m",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := sink.format(test.entry); got != test.want {
+				t.Errorf("format() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	sink, err := newSyslogSink(configuration.Sink{Network: "udp", Address: listener.LocalAddr().String()}, "host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	entries := []Entry{
+		{Time: testTime, Level: logrus.InfoLevel, Source: "web", Stream: "stdout", Message: "first"},
+		{Time: testTime, Level: logrus.InfoLevel, Source: "web", Stream: "stdout", Message: "second"},
+	}
+	if err := sink.Send(entries); err != nil {
+		t.Fatal(err)
+	}
+	buffer := make([]byte, 2048)
+	for _, entry := range entries {
+		_ = listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+		count, _, err := listener.ReadFrom(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(buffer[:count]), sink.format(entry); got != want {
+			t.Errorf("datagram = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestSyslogTCPFraming(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		reader := bufio.NewReader(conn)
+		var messages []string
+		for len(messages) < 2 {
+			length, err := reader.ReadString(' ')
+			if err != nil {
+				break
+			}
+			size, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+			if err != nil {
+				break
+			}
+			message := make([]byte, size)
+			if _, err := io.ReadFull(reader, message); err != nil {
+				break
+			}
+			messages = append(messages, string(message))
+		}
+		received <- messages
+	}()
+	sink, err := newSyslogSink(configuration.Sink{Network: "tcp", Address: listener.Addr().String()}, "host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	entries := []Entry{
+		{Time: testTime, Level: logrus.InfoLevel, Source: "web", Stream: "stdout", Message: "with spaces in it"},
+		{Time: testTime, Level: logrus.WarnLevel, Source: "web", Stream: "stderr", Message: "multi\nline"},
+	}
+	if err := sink.Send(entries); err != nil {
+		t.Fatal(err)
+	}
+	messages := <-received
+	if len(messages) != len(entries) {
+		t.Fatalf("received %d messages, want %d", len(messages), len(entries))
+	}
+	for idx, entry := range entries {
+		if want := sink.format(entry); messages[idx] != want {
+			t.Errorf("message %d = %q, want %q", idx, messages[idx], want)
+		}
+	}
+}
+
+func TestSyslogFacility(t *testing.T) {
+	for _, test := range []struct {
+		facility *int
+		want     int
+	}{{nil, syslogDefaultFacility}, {facility(0), 0}, {facility(23), 23}} {
+		sink, err := newSyslogSink(configuration.Sink{Address: "127.0.0.1:514", Facility: test.facility}, "host")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sink.facility != test.want {
+			t.Errorf("facility = %d, want %d", sink.facility, test.want)
+		}
+	}
+}
+
+func TestNewSyslogSinkErrors(t *testing.T) {
+	tests := []configuration.Sink{
+		{Network: "sctp", Address: "127.0.0.1:514"},
+		{Network: "udp"},
+		{Address: "127.0.0.1:514", Facility: facility(-1)},
+		{Address: "127.0.0.1:514", Facility: facility(24)},
+	}
+	for _, config := range tests {
+		if _, err := newSyslogSink(config, "host"); err == nil {
+			t.Errorf("newSyslogSink(%+v) succeeded, want error", config)
+		}
+	}
+}
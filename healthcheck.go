@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/vvhq/exorsus/configuration"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"time"
+)
+
+const healthcheckCommand string = "healthcheck"
+const healthcheckTokenEnv string = "EXORSUS_TOKEN"
+
+// healthcheck probes /healthz and /readyz of the running exorsus and returns
+// the exit code for a container HEALTHCHECK: 0 when both answer 200.
+func healthcheck(arguments []string) int {
+	flags := flag.NewFlagSet(healthcheckCommand, flag.ExitOnError)
+	configDir := flags.String("config", "./config/", "application directory path")
+	timeout := flags.Int("timeout", 5, "request timeout in seconds")
+	certFile := flags.String("cert", "", "client certificate file for TLS client authentication")
+	keyFile := flags.String("key", "", "client key file for TLS client authentication")
+	_ = flags.Parse(arguments)
+	config := configuration.New(path.Join(path.Dir(*configDir), configuration.DefaultConfigurationFileName))
+
+	client, baseURL, err := healthcheckClient(config, time.Duration(*timeout)*time.Second, *certFile, *keyFile)
+	if err != nil {
+		fmt.Printf("Can not create client: %s\n", err.Error())
+		return 1
+	}
+	healthy := true
+	for _, endpoint := range []string{"/v1/healthz", "/v1/readyz"} {
+		request, err := http.NewRequest(http.MethodGet, baseURL+endpoint, nil)
+		if err != nil {
+			fmt.Printf("%s: %s\n", endpoint, err.Error())
+			return 1
+		}
+		if token := os.Getenv(healthcheckTokenEnv); token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		response, err := client.Do(request)
+		if err != nil {
+			fmt.Printf("%s: %s\n", endpoint, err.Error())
+			return 1
+		}
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 64*1024))
+		_ = response.Body.Close()
+		fmt.Printf("%s: %d %s\n", endpoint, response.StatusCode, bytes.TrimSpace(body))
+		if response.StatusCode != http.StatusOK {
+			healthy = false
+		}
+	}
+	if !healthy {
+		return 1
+	}
+	return 0
+}
+
+// healthcheckClient connects over the unix socket when one is configured,
+// otherwise over TCP to the loopback address for a wildcard listen address.
+// With TLS the configured server certificate is pinned, as its names need
+// not match the address dialed. The client certificate is presented when
+// given and must be given when the server requires one.
+func healthcheckClient(config *configuration.Configuration, timeout time.Duration, certFile string, keyFile string) (*http.Client, string, error) {
+	transport := &http.Transport{}
+	client := &http.Client{Timeout: timeout, Transport: transport}
+	if config.ListenSocket != "" {
+		socketPath := config.ListenSocket
+		transport.DialContext = func(ctx context.Context, network string, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}
+		return client, "http://exorsus", nil
+	}
+	host := config.ListenAddress
+	if host == "" || net.ParseIP(host) != nil && net.ParseIP(host).IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(config.GetListenPort()))
+	if !config.TLSEnabled() {
+		return client, "http://" + address, nil
+	}
+	certificate, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+	if err != nil {
+		return nil, "", err
+	}
+	pinned := certificate.Certificate[0]
+	var clientCertificates []tls.Certificate
+	if certFile != "" || keyFile != "" {
+		clientCertificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("client certificate: %s", err.Error())
+		}
+		clientCertificates = append(clientCertificates, clientCertificate)
+	} else if config.GetTLSClientAuth() == configuration.TLSClientAuthRequire {
+		return nil, "", errors.New("TLSClientAuth requires a client certificate, pass -cert and -key")
+	}
+	transport.TLSClientConfig = &tls.Config{
+		Certificates:       clientCertificates,
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 || !bytes.Equal(rawCerts[0], pinned) {
+				return errors.New("server certificate does not match " + config.TLSCertFile)
+			}
+			return nil
+		}}
+	return client, "https://" + address, nil
+}
@@ -1,15 +1,77 @@
 package logging
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/natefinch/lumberjack.v2"
+	"hash/fnv"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 )
 
+const colorReset string = "\x1b[0m"
+const colorStdErr string = "\x1b[31m"
+
+var mirrorColors = []string{"\x1b[32m", "\x1b[33m", "\x1b[34m", "\x1b[35m", "\x1b[36m", "\x1b[92m", "\x1b[93m", "\x1b[94m", "\x1b[95m", "\x1b[96m"}
+
+// Mirror copies application output lines to the exorsus own stdout/stderr,
+// so they show up in `docker logs`.
+type Mirror struct {
+	name   string
+	raw    bool
+	color  string
+	stdOut io.Writer
+	stdErr io.Writer
+}
+
+func (mirror *Mirror) StdOut(item string) {
+	mirror.write(mirror.stdOut, "stdout", item)
+}
+
+func (mirror *Mirror) StdErr(item string) {
+	mirror.write(mirror.stdErr, "stderr", item)
+}
+
+// write emits the whole item with a single Write call, so lines from
+// different applications do not interleave.
+func (mirror *Mirror) write(output io.Writer, stream string, item string) {
+	var builder strings.Builder
+	for _, line := range strings.Split(item, "\n") {
+		if !mirror.raw {
+			mirror.writePrefix(&builder, stream)
+		}
+		builder.WriteString(line)
+		builder.WriteString("\n")
+	}
+	_, _ = io.WriteString(output, builder.String())
+}
+
+func (mirror *Mirror) writePrefix(builder *strings.Builder, stream string) {
+	if mirror.color == "" {
+		builder.WriteString(fmt.Sprintf("%s %s | ", mirror.name, stream))
+		return
+	}
+	streamColor := mirror.color
+	if stream == "stderr" {
+		streamColor = colorStdErr
+	}
+	builder.WriteString(fmt.Sprintf("%s%s%s %s%s%s | ", mirror.color, mirror.name, colorReset, streamColor, stream, colorReset))
+}
+
+func NewMirror(name string, raw bool, color bool, stdOut io.Writer, stdErr io.Writer) *Mirror {
+	mirror := &Mirror{name: name, raw: raw, stdOut: stdOut, stdErr: stdErr}
+	if color {
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(name))
+		mirror.color = mirrorColors[hash.Sum32()%uint32(len(mirrorColors))]
+	}
+	return mirror
+}
+
 type FileHook struct {
 	logger       *logrus.Logger
 	lumberLogger *lumberjack.Logger
@@ -72,6 +134,48 @@ func NewFileHook(parentLogger *logrus.Logger, logPath string, maxSize int, maxBa
 	return &FileHook{logger: fileLogger, lumberLogger: lumberLogger, parentLogger: parentLogger}, nil
 }
 
+// AuditLog appends records as JSON lines to a file rotated like the exorsus
+// log. Records written to a nil AuditLog are discarded.
+type AuditLog struct {
+	lumberLogger *lumberjack.Logger
+}
+
+func (auditLog *AuditLog) Write(record interface{}) error {
+	if auditLog == nil {
+		return nil
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = auditLog.lumberLogger.Write(append(line, '\n'))
+	return err
+}
+
+func (auditLog *AuditLog) Rotate() error {
+	if auditLog == nil {
+		return nil
+	}
+	return auditLog.lumberLogger.Rotate()
+}
+
+func (auditLog *AuditLog) Close() error {
+	if auditLog == nil {
+		return nil
+	}
+	return auditLog.lumberLogger.Close()
+}
+
+func NewAuditLog(logPath string, maxSize int, maxBackups int, maxAge int, localTime bool) *AuditLog {
+	return &AuditLog{lumberLogger: &lumberjack.Logger{
+		Filename:   logPath,
+		MaxSize:    maxSize,
+		MaxBackups: maxBackups,
+		MaxAge:     maxAge,
+		LocalTime:  localTime,
+	}}
+}
+
 func NewLogger(output io.Writer, level logrus.Level) *logrus.Logger {
 	logger := logrus.New()
 	logger.SetLevel(level)
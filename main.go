@@ -1,36 +1,63 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"github.com/vvhq/exorsus/application"
 	"github.com/vvhq/exorsus/configuration"
+	"github.com/vvhq/exorsus/events"
+	"github.com/vvhq/exorsus/forwarding"
 	"github.com/vvhq/exorsus/logging"
 	"github.com/vvhq/exorsus/process"
 	"github.com/vvhq/exorsus/rest"
 	"github.com/vvhq/exorsus/signals"
-	"github.com/vvhq/exorsus/status"
 	"github.com/vvhq/exorsus/version"
+	"github.com/vvhq/exorsus/webhooks"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/signal"
 	"path"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == healthcheckCommand {
+		os.Exit(healthcheck(os.Args[2:]))
+	}
 	configDir := flag.String("config", "./config/", "application directory path")
 	printVersion := flag.Bool("version", false, "print version number")
+	hashToken := flag.Bool("hash-token", false, "read API token from stdin and print its hash")
 	flag.Parse()
 	if *printVersion {
 		fmt.Println(version.Version)
 		os.Exit(0)
 	}
+	if *hashToken {
+		token, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			fmt.Printf("Can not read token: %s\n", err.Error())
+			os.Exit(1)
+		}
+		fmt.Println(configuration.HashToken(strings.TrimSpace(token)))
+		os.Exit(0)
+	}
 	configDirPath := path.Dir(*configDir)
 	configPath := path.Join(configDirPath, configuration.DefaultConfigurationFileName)
 	config := configuration.New(configPath)
+	token, err := config.InitTokenFile(configDirPath)
+	if err != nil {
+		fmt.Printf("Can not create token file '%s': %s\n", config.TokenFile, err.Error())
+		os.Exit(1)
+	}
+	if token != "" {
+		// Only the hash is stored, so the token is shown this once.
+		fmt.Printf("Generated API token for admin, stored hashed in '%s': %s\n", config.TokenFile, token)
+	}
 
 	var logger = logging.NewLogger(os.Stdout, config.GetLogLevel())
 	loggerHook, err := logging.NewFileHook(logger,
@@ -47,11 +74,15 @@ func main() {
 	} else {
 		logger.AddHook(loggerHook)
 	}
+	forwarder := forwarding.New(config.Sinks, logger)
+	logger.AddHook(forwarder)
+	bus := events.NewBus(config.GetEventReplaySize())
 	logger.WithField("Source", "Main").Trace("Exorsus starting")
 	maxTimeout := 0
 	var wg sync.WaitGroup
-	storage := application.NewStorage(path.Join(configDirPath, configuration.DefaultApplicationsFileName), logger)
+	storage := application.NewStorage(path.Join(configDirPath, configuration.DefaultApplicationsFileName), bus, logger)
 	procManager := process.NewManager(&wg, logger)
+	dispatcher := webhooks.New(config.Webhooks, config.GetWebhookDeadLetter(), bus, procManager.TailStdErr, logger)
 	for _, app := range storage.List() {
 		appClone, err := app.Copy()
 		if err != nil {
@@ -60,21 +91,34 @@ func main() {
 				WithField("error", err.Error()).
 				Error("Skip application due error")
 		} else {
-			proc := process.New(appClone, status.New(config.GetMaxStdLines()), &wg, config, logger)
+			proc := process.New(appClone, &wg, config, forwarder, bus, logger)
 			procManager.Append(proc)
 			if appClone.Timeout > maxTimeout {
 				maxTimeout = appClone.Timeout
 			}
 		}
 	}
-	restService := rest.New(config.GetListenPort(), storage, procManager, &wg, config, logger)
+	var auditLog *logging.AuditLog
+	if !config.DisableAuditLog {
+		auditLog = logging.NewAuditLog(config.GetAuditLog(), config.LogMaxSize, config.LogMaxBackups, config.LogMaxAge, config.LogLocalTime)
+	}
+	restService := rest.New(config.GetListenPort(), storage, procManager, &wg, config, forwarder, dispatcher, bus, auditLog, logger)
+	restService.AddHealthCheck("signals", signals.Running)
+	// REST refuses invalid configuration before any application runs.
+	err = restService.Start()
+	if err != nil {
+		logger.
+			WithField("source", "main").
+			WithField("error", err.Error()).
+			Error("Can not start REST")
+		os.Exit(1)
+	}
 	procManager.StartAll()
-	restService.Start()
 	maxTimeout = maxTimeout + config.GetShutdownTimeout()
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGHUP)
 	wg.Add(1)
-	go signals.HandleSignals(&wg, signalChan, procManager, restService, maxTimeout, config, logger, loggerHook)
+	go signals.HandleSignals(&wg, signalChan, procManager, restService, maxTimeout, config, logger, loggerHook, auditLog)
 	logger.
 		WithField("source", "main").
 		Infof("Exorsus stared; Pid: %d", os.Getpid())
@@ -95,4 +139,7 @@ func main() {
 	logger.
 		WithField("source", "main").
 		Info("Exorsus stopped")
+	_ = auditLog.Close()
+	dispatcher.Close()
+	forwarder.Close()
 }
@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"github.com/vvhq/exorsus/forwarding"
+	"github.com/vvhq/exorsus/process"
+	"github.com/vvhq/exorsus/status"
+	"github.com/vvhq/exorsus/version"
+	"github.com/vvhq/exorsus/webhooks"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+)
+
+var startTime = time.Now()
+
+// Write writes the metrics of the applications, of the REST requests, of the
+// log forwarding sinks, of the webhooks and of exorsus itself.
+func Write(output io.Writer, applications []process.Metrics, requests *Requests, sinks []forwarding.SinkStatus, hooks []webhooks.WebhookStatus) error {
+	writer := newWriter(output)
+	writeApplications(writer, applications)
+	if requests != nil {
+		requests.write(writer)
+	}
+	writeSinks(writer, sinks)
+	writeWebhooks(writer, hooks)
+	writeRuntime(writer)
+	return writer.buffer.Flush()
+}
+
+func writeApplications(writer *writer, applications []process.Metrics) {
+	sort.Slice(applications, func(i, j int) bool {
+		return applications[i].Name < applications[j].Name
+	})
+	now := time.Now()
+
+	writer.family("exorsus_application_state", typeGauge, "Current state of the application, 1 for the state it is in.")
+	for _, app := range applications {
+		for state := status.Stopped; state <= status.Failed; state++ {
+			writer.sample("exorsus_application_state", boolValue(app.State == state),
+				"application", app.Name, "state", process.StateName(state))
+		}
+	}
+	writer.family("exorsus_application_up", typeGauge, "Whether the application is started.")
+	for _, app := range applications {
+		writer.sample("exorsus_application_up", boolValue(app.State == status.Started), "application", app.Name)
+	}
+	writer.family("exorsus_application_healthy", typeGauge, "Whether the application is started and not crash looping.")
+	for _, app := range applications {
+		writer.sample("exorsus_application_healthy", boolValue(app.Healthy), "application", app.Name)
+	}
+	writer.family("exorsus_application_starts_total", typeCounter, "Number of times the application was started.")
+	for _, app := range applications {
+		writer.sample("exorsus_application_starts_total", float64(app.Starts), "application", app.Name)
+	}
+	writer.family("exorsus_application_restarts_total", typeCounter, "Number of times the application was started after its first start.")
+	for _, app := range applications {
+		restarts := uint64(0)
+		if app.Starts > 1 {
+			restarts = app.Starts - 1
+		}
+		writer.sample("exorsus_application_restarts_total", float64(restarts), "application", app.Name)
+	}
+	writer.family("exorsus_application_last_exit_code", typeGauge, "Exit code of the last run of the application, -1 when it could not be determined.")
+	for _, app := range applications {
+		writer.sample("exorsus_application_last_exit_code", float64(app.Code), "application", app.Name)
+	}
+	writer.family("exorsus_application_start_time_seconds", typeGauge, "Unix time of the last start of the application.")
+	for _, app := range applications {
+		if !app.StartTime.IsZero() {
+			writer.sample("exorsus_application_start_time_seconds", float64(app.StartTime.UnixNano())/1e9, "application", app.Name)
+		}
+	}
+	writer.family("exorsus_application_uptime_seconds", typeGauge, "Seconds since the application started, 0 when it is not started.")
+	for _, app := range applications {
+		uptime := 0.0
+		if app.State == status.Started && !app.StartTime.IsZero() {
+			uptime = now.Sub(app.StartTime).Seconds()
+		}
+		writer.sample("exorsus_application_uptime_seconds", uptime, "application", app.Name)
+	}
+	writer.family("exorsus_application_output_lines_total", typeCounter, "Lines captured from the output of the application.")
+	for _, app := range applications {
+		writer.sample("exorsus_application_output_lines_total", float64(app.StdOutLines), "application", app.Name, "stream", status.StreamStdOut)
+		writer.sample("exorsus_application_output_lines_total", float64(app.StdErrLines), "application", app.Name, "stream", status.StreamStdErr)
+	}
+	writer.family("exorsus_application_output_dropped_lines_total", typeCounter, "Captured lines evicted from the output buffer of the application.")
+	for _, app := range applications {
+		writer.sample("exorsus_application_output_dropped_lines_total", float64(app.StdOutDroppedLines), "application", app.Name, "stream", status.StreamStdOut)
+		writer.sample("exorsus_application_output_dropped_lines_total", float64(app.StdErrDroppedLines), "application", app.Name, "stream", status.StreamStdErr)
+	}
+
+	procStats := make(map[string]procStat)
+	for _, app := range applications {
+		if app.State != status.Started && app.State != status.Stopping && app.State != status.Failed {
+			continue
+		}
+		if stat, ok := readProcStat(app.Pid); ok {
+			procStats[app.Name] = stat
+		}
+	}
+	if len(procStats) == 0 {
+		return
+	}
+	writer.family("exorsus_application_cpu_seconds_total", typeCounter, "User and system CPU time of the application process.")
+	for _, app := range applications {
+		if stat, ok := procStats[app.Name]; ok {
+			writer.sample("exorsus_application_cpu_seconds_total", stat.cpuSeconds, "application", app.Name)
+		}
+	}
+	writer.family("exorsus_application_resident_memory_bytes", typeGauge, "Resident memory of the application process.")
+	for _, app := range applications {
+		if stat, ok := procStats[app.Name]; ok {
+			writer.sample("exorsus_application_resident_memory_bytes", stat.rssBytes, "application", app.Name)
+		}
+	}
+}
+
+func writeSinks(writer *writer, sinks []forwarding.SinkStatus) {
+	if len(sinks) == 0 {
+		return
+	}
+	writer.family("exorsus_forwarding_sent_total", typeCounter, "Log entries delivered to the sink.")
+	for _, sink := range sinks {
+		writer.sample("exorsus_forwarding_sent_total", float64(sink.Sent), "sink", sink.Name, "type", sink.Type)
+	}
+	writer.family("exorsus_forwarding_dropped_total", typeCounter, "Log entries dropped because the sink buffer was full or delivery failed.")
+	for _, sink := range sinks {
+		writer.sample("exorsus_forwarding_dropped_total", float64(sink.Dropped), "sink", sink.Name, "type", sink.Type)
+	}
+}
+
+func writeWebhooks(writer *writer, hooks []webhooks.WebhookStatus) {
+	if len(hooks) == 0 {
+		return
+	}
+	writer.family("exorsus_webhook_delivered_total", typeCounter, "Events delivered to the webhook.")
+	for _, hook := range hooks {
+		writer.sample("exorsus_webhook_delivered_total", float64(hook.Delivered), "webhook", hook.Name)
+	}
+	writer.family("exorsus_webhook_failed_total", typeCounter, "Events which could not be delivered to the webhook.")
+	for _, hook := range hooks {
+		writer.sample("exorsus_webhook_failed_total", float64(hook.Failed), "webhook", hook.Name)
+	}
+}
+
+func writeRuntime(writer *writer) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	writer.family("exorsus_build_info", typeGauge, "Version of exorsus and of the Go runtime it was built with.")
+	writer.sample("exorsus_build_info", 1, "version", version.Version, "goversion", runtime.Version())
+	writer.family("go_goroutines", typeGauge, "Number of goroutines that currently exist.")
+	writer.sample("go_goroutines", float64(runtime.NumGoroutine()))
+	writer.family("go_threads", typeGauge, "Number of OS threads created.")
+	threads, _ := runtime.ThreadCreateProfile(nil)
+	writer.sample("go_threads", float64(threads))
+	writer.family("go_gc_cycles_total", typeCounter, "Number of completed GC cycles.")
+	writer.sample("go_gc_cycles_total", float64(memStats.NumGC))
+	writer.family("go_gc_pause_seconds_total", typeCounter, "Total time spent in GC stop-the-world pauses.")
+	writer.sample("go_gc_pause_seconds_total", float64(memStats.PauseTotalNs)/1e9)
+	writer.family("go_memstats_alloc_bytes", typeGauge, "Bytes of allocated heap objects.")
+	writer.sample("go_memstats_alloc_bytes", float64(memStats.Alloc))
+	writer.family("go_memstats_alloc_bytes_total", typeCounter, "Cumulative bytes allocated for heap objects.")
+	writer.sample("go_memstats_alloc_bytes_total", float64(memStats.TotalAlloc))
+	writer.family("go_memstats_heap_inuse_bytes", typeGauge, "Bytes in in-use heap spans.")
+	writer.sample("go_memstats_heap_inuse_bytes", float64(memStats.HeapInuse))
+	writer.family("go_memstats_heap_objects", typeGauge, "Number of allocated heap objects.")
+	writer.sample("go_memstats_heap_objects", float64(memStats.HeapObjects))
+	writer.family("go_memstats_sys_bytes", typeGauge, "Bytes of memory obtained from the OS.")
+	writer.sample("go_memstats_sys_bytes", float64(memStats.Sys))
+
+	writer.family("process_start_time_seconds", typeGauge, "Unix time exorsus started.")
+	writer.sample("process_start_time_seconds", float64(startTime.UnixNano())/1e9)
+	if stat, ok := readProcStat(os.Getpid()); ok {
+		writer.family("process_cpu_seconds_total", typeCounter, "User and system CPU time of exorsus.")
+		writer.sample("process_cpu_seconds_total", stat.cpuSeconds)
+		writer.family("process_resident_memory_bytes", typeGauge, "Resident memory of exorsus.")
+		writer.sample("process_resident_memory_bytes", stat.rssBytes)
+	}
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the Prometheus text exposition format written here.
+const ContentType string = "text/plain; version=0.0.4; charset=utf-8"
+
+const typeGauge string = "gauge"
+const typeCounter string = "counter"
+const typeHistogram string = "histogram"
+
+var labelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+var helpEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n")
+
+// writer writes metric families in the Prometheus text format. Labels are
+// given as name, value pairs.
+type writer struct {
+	buffer *bufio.Writer
+}
+
+func (writer *writer) family(name string, kind string, help string) {
+	writer.buffer.WriteString("# HELP " + name + " " + helpEscaper.Replace(help) + "\n")
+	writer.buffer.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+func (writer *writer) sample(name string, value float64, labels ...string) {
+	writer.buffer.WriteString(name)
+	if len(labels) > 1 {
+		writer.buffer.WriteByte('{')
+		for idx := 0; idx+1 < len(labels); idx += 2 {
+			if idx > 0 {
+				writer.buffer.WriteByte(',')
+			}
+			writer.buffer.WriteString(labels[idx] + "=\"" + labelEscaper.Replace(labels[idx+1]) + "\"")
+		}
+		writer.buffer.WriteByte('}')
+	}
+	writer.buffer.WriteString(" " + formatValue(value) + "\n")
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func newWriter(output io.Writer) *writer {
+	return &writer{buffer: bufio.NewWriter(output)}
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// clockTicks is USER_HZ, which is 100 on every Linux architecture Go supports.
+const clockTicks float64 = 100
+
+type procStat struct {
+	cpuSeconds float64
+	rssBytes   float64
+}
+
+// readProcStat reads the CPU time and resident memory of a process from
+// /proc; ok is false where /proc is not available.
+func readProcStat(pid int) (procStat, bool) {
+	if pid <= 0 {
+		return procStat{}, false
+	}
+	data, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return procStat{}, false
+	}
+	// The command name may contain spaces, fields are counted after it.
+	end := strings.LastIndexByte(string(data), ')')
+	if end < 0 {
+		return procStat{}, false
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	// utime, stime and rss are fields 14, 15 and 24 of stat(5); fields here
+	// start at field 3.
+	if len(fields) < 22 {
+		return procStat{}, false
+	}
+	utime, err := strconv.ParseFloat(fields[11], 64)
+	if err != nil {
+		return procStat{}, false
+	}
+	stime, err := strconv.ParseFloat(fields[12], 64)
+	if err != nil {
+		return procStat{}, false
+	}
+	rss, err := strconv.ParseFloat(fields[21], 64)
+	if err != nil {
+		return procStat{}, false
+	}
+	return procStat{
+		cpuSeconds: (utime + stime) / clockTicks,
+		rssBytes:   rss * float64(os.Getpagesize())}, true
+}
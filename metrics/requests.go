@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the request latency
+// histogram.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type requestKey struct {
+	route  string
+	method string
+	code   int
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Requests keeps a latency histogram per route template, method and status
+// code of the REST service.
+type Requests struct {
+	buckets []float64
+	series  map[requestKey]*histogram
+	lock    sync.Mutex
+}
+
+func (requests *Requests) Observe(route string, method string, code int, duration time.Duration) {
+	key := requestKey{route: route, method: method, code: code}
+	seconds := duration.Seconds()
+	requests.lock.Lock()
+	defer requests.lock.Unlock()
+	series, ok := requests.series[key]
+	if !ok {
+		series = &histogram{counts: make([]uint64, len(requests.buckets))}
+		requests.series[key] = series
+	}
+	for idx, bound := range requests.buckets {
+		if seconds <= bound {
+			series.counts[idx]++
+		}
+	}
+	series.count++
+	series.sum += seconds
+}
+
+func (requests *Requests) write(writer *writer) {
+	requests.lock.Lock()
+	defer requests.lock.Unlock()
+	keys := make([]requestKey, 0, len(requests.series))
+	for key := range requests.series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].code < keys[j].code
+	})
+	writer.family("exorsus_http_request_duration_seconds", typeHistogram, "Latency of REST requests by route template, method and status code.")
+	for _, key := range keys {
+		series := requests.series[key]
+		code := strconv.Itoa(key.code)
+		for idx, bound := range requests.buckets {
+			writer.sample("exorsus_http_request_duration_seconds_bucket", float64(series.counts[idx]),
+				"route", key.route, "method", key.method, "code", code, "le", formatValue(bound))
+		}
+		writer.sample("exorsus_http_request_duration_seconds_bucket", float64(series.count),
+			"route", key.route, "method", key.method, "code", code, "le", "+Inf")
+		writer.sample("exorsus_http_request_duration_seconds_sum", series.sum,
+			"route", key.route, "method", key.method, "code", code)
+		writer.sample("exorsus_http_request_duration_seconds_count", float64(series.count),
+			"route", key.route, "method", key.method, "code", code)
+	}
+}
+
+func NewRequests(buckets []float64) *Requests {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &Requests{buckets: sorted, series: make(map[requestKey]*histogram)}
+}
@@ -0,0 +1,93 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// ExecResult is the outcome of a command run in the context of an
+// application. Code is -1 when the command was killed.
+type ExecResult struct {
+	Code      int
+	Stdout    string
+	Stderr    string
+	TimedOut  bool
+	Truncated bool
+	Duration  time.Duration
+}
+
+// limitedBuffer keeps the first limit bytes written to it and drops the rest.
+type limitedBuffer struct {
+	buffer    bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (buffer *limitedBuffer) Write(data []byte) (int, error) {
+	room := buffer.limit - buffer.buffer.Len()
+	if len(data) > room {
+		buffer.truncated = true
+		if room > 0 {
+			buffer.buffer.Write(data[:room])
+		}
+		return len(data), nil
+	}
+	buffer.buffer.Write(data)
+	return len(data), nil
+}
+
+// Exec runs a short-lived command as the user and group, in the working
+// directory and with the environment of the application, and waits for it.
+// The command and everything it started are killed once timeout expired,
+// which also ends the wait for children keeping stdout or stderr open. An
+// error is only returned when the command could not be started.
+func (process *Process) Exec(command string, arguments []string, timeout time.Duration) (ExecResult, error) {
+	execContext, execCancel := context.WithTimeout(context.Background(), timeout)
+	defer execCancel()
+	execCommand := exec.Command(command, arguments...)
+	execCommand.Dir = process.app.WorkDir
+	execCommand.Env = process.environment()
+	execCommand.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Credential: process.findCredential()}
+	stdout := &limitedBuffer{limit: process.config.GetExecMaxOutput()}
+	stderr := &limitedBuffer{limit: process.config.GetExecMaxOutput()}
+	execCommand.Stdout = stdout
+	execCommand.Stderr = stderr
+	process.logger.
+		WithField("source", "process").
+		WithField("process", process.Name).
+		WithField("path", execCommand.Path).
+		WithField("dir", execCommand.Dir).
+		WithField("args", execCommand.Args).
+		Info("Exec command in application context")
+	started := time.Now()
+	err := execCommand.Start()
+	if err != nil {
+		process.logger.
+			WithField("source", "process").
+			WithField("process", process.Name).
+			WithField("path", execCommand.Path).
+			WithField("error", err.Error()).
+			Error("Can not exec command")
+		return ExecResult{}, err
+	}
+	waited := make(chan struct{})
+	go func(pid int) {
+		select {
+		case <-execContext.Done():
+			_ = syscall.Kill(-pid, syscall.SIGKILL)
+		case <-waited:
+		}
+	}(execCommand.Process.Pid)
+	_ = execCommand.Wait()
+	close(waited)
+	return ExecResult{
+		Code:      execCommand.ProcessState.ExitCode(),
+		Stdout:    stdout.buffer.String(),
+		Stderr:    stderr.buffer.String(),
+		TimedOut:  execContext.Err() == context.DeadlineExceeded,
+		Truncated: stdout.truncated || stderr.truncated,
+		Duration:  time.Since(started)}, nil
+}
@@ -0,0 +1,53 @@
+package process
+
+import (
+	"github.com/vvhq/exorsus/application"
+	"testing"
+	"time"
+)
+
+func TestExec(t *testing.T) {
+	proc := testProcess(t, application.Application{Name: "exec", Command: "/bin/sleep", Arguments: "30",
+		Environment: []application.Environment{{Name: "EXEC_TEST", Value: "from-app"}}})
+
+	result, err := proc.Exec("/bin/sh", []string{"-c", "echo $EXEC_TEST; echo oops >&2; exit 3"}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Code != 3 || result.Stdout != "from-app\n" || result.Stderr != "oops\n" || result.TimedOut || result.Truncated {
+		t.Errorf("result = %+v", result)
+	}
+
+	if _, err := proc.Exec("/nonexistent/command", nil, time.Second); err == nil {
+		t.Error("exec of a missing command did not fail")
+	}
+}
+
+func TestExecTimeout(t *testing.T) {
+	proc := testProcess(t, application.Application{Name: "exec", Command: "/bin/sleep", Arguments: "30"})
+
+	// The background child keeps stdout open after the shell is killed.
+	result, err := proc.Exec("/bin/sh", []string{"-c", "sleep 30 & echo started; wait"}, 300*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.TimedOut || result.Code != -1 || result.Stdout != "started\n" {
+		t.Errorf("result = %+v, want the killed command", result)
+	}
+	if result.Duration > 5*time.Second {
+		t.Errorf("exec took %s, want the children killed with the command", result.Duration)
+	}
+}
+
+func TestExecTruncated(t *testing.T) {
+	proc := testProcess(t, application.Application{Name: "exec", Command: "/bin/sleep", Arguments: "30"})
+	proc.config.ExecMaxOutput = 8
+
+	result, err := proc.Exec("/bin/sh", []string{"-c", "echo 0123456789"}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Truncated || result.Stdout != "01234567" {
+		t.Errorf("result = %+v, want stdout cut at 8 bytes", result)
+	}
+}
@@ -0,0 +1,245 @@
+package process
+
+import (
+	"encoding/json"
+	"github.com/vvhq/exorsus/configuration"
+	"github.com/vvhq/exorsus/status"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var levelKeys = []string{"level", "lvl", "severity", "log.level", "loglevel"}
+var messageKeys = []string{"msg", "message", "short_message", "text"}
+var timeKeys = []string{"time", "ts", "timestamp", "@timestamp", "t"}
+
+// parseLine converts a line of output into an item according to the
+// application log format. Lines which do not match the format are kept as text.
+func parseLine(format string, stream string, line string) status.Item {
+	item := status.Item{Time: time.Now(), Stream: stream, Level: defaultLevel(stream), Message: line, Line: line}
+	var fields map[string]interface{}
+	switch format {
+	case configuration.LogFormatJSON:
+		fields = parseJSON(line)
+	case configuration.LogFormatLogfmt:
+		fields = parseLogfmt(line)
+	}
+	if len(fields) == 0 {
+		return item
+	}
+	if level, ok := extractField(fields, levelKeys); ok {
+		item.Level = normalizeLevel(level, item.Level)
+	}
+	if message, ok := extractField(fields, messageKeys); ok {
+		item.Message = toString(message)
+	} else {
+		item.Message = ""
+	}
+	if timestamp, ok := extractField(fields, timeKeys); ok {
+		if parsed, ok := parseTime(timestamp); ok {
+			item.Time = parsed
+		} else {
+			fields["time"] = timestamp
+		}
+	}
+	if len(fields) > 0 {
+		item.Fields = fields
+	}
+	return item
+}
+
+func defaultLevel(stream string) string {
+	if stream == status.StreamStdErr {
+		return status.LevelError
+	}
+	return status.LevelInfo
+}
+
+func parseJSON(line string) map[string]interface{} {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "{") {
+		return nil
+	}
+	decoder := json.NewDecoder(strings.NewReader(trimmed))
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// parseLogfmt parses key=value pairs, values may be double quoted.
+// Bare words without '=' become the message unless a message key is present.
+func parseLogfmt(line string) map[string]interface{} {
+	fields := make(map[string]interface{})
+	var words []string
+	pairs := 0
+	idx := 0
+	for idx < len(line) {
+		for idx < len(line) && line[idx] == ' ' {
+			idx++
+		}
+		start := idx
+		for idx < len(line) && line[idx] != '=' && line[idx] != ' ' {
+			idx++
+		}
+		key := line[start:idx]
+		if key == "" {
+			if idx < len(line) && line[idx] == '=' {
+				return nil
+			}
+			continue
+		}
+		if idx >= len(line) || line[idx] != '=' {
+			words = append(words, key)
+			continue
+		}
+		idx++
+		if idx < len(line) && line[idx] == '"' {
+			end := idx + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil
+			}
+			value, err := strconv.Unquote(line[idx : end+1])
+			if err != nil {
+				return nil
+			}
+			fields[key] = value
+			idx = end + 1
+		} else {
+			start = idx
+			for idx < len(line) && line[idx] != ' ' {
+				idx++
+			}
+			fields[key] = line[start:idx]
+		}
+		pairs++
+	}
+	if pairs == 0 {
+		return nil
+	}
+	if len(words) > 0 && !hasField(fields, messageKeys) {
+		fields["msg"] = strings.Join(words, " ")
+	}
+	return fields
+}
+
+func hasField(fields map[string]interface{}, keys []string) bool {
+	for _, key := range keys {
+		if _, ok := fields[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func extractField(fields map[string]interface{}, keys []string) (interface{}, bool) {
+	for _, key := range keys {
+		value, ok := fields[key]
+		if ok {
+			delete(fields, key)
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func normalizeLevel(value interface{}, fallback string) string {
+	if number, ok := value.(json.Number); ok {
+		// bunyan / pino numeric levels
+		code, err := number.Int64()
+		if err != nil {
+			return fallback
+		}
+		switch {
+		case code >= 60:
+			return status.LevelFatal
+		case code >= 50:
+			return status.LevelError
+		case code >= 40:
+			return status.LevelWarn
+		case code >= 30:
+			return status.LevelInfo
+		case code >= 20:
+			return status.LevelDebug
+		default:
+			return status.LevelTrace
+		}
+	}
+	switch strings.ToLower(toString(value)) {
+	case "trace":
+		return status.LevelTrace
+	case "debug", "dbug":
+		return status.LevelDebug
+	case "info", "information", "notice":
+		return status.LevelInfo
+	case "warn", "warning":
+		return status.LevelWarn
+	case "error", "err", "eror":
+		return status.LevelError
+	case "fatal", "panic", "critical", "crit", "alert", "emerg", "emergency":
+		return status.LevelFatal
+	default:
+		return fallback
+	}
+}
+
+func parseTime(value interface{}) (time.Time, bool) {
+	switch typed := value.(type) {
+	case json.Number:
+		number, err := typed.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		return epochTime(number), true
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999"} {
+			parsed, err := time.Parse(layout, typed)
+			if err == nil {
+				return parsed, true
+			}
+		}
+		number, err := strconv.ParseFloat(typed, 64)
+		if err == nil {
+			return epochTime(number), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// epochTime accepts seconds, milliseconds, microseconds or nanoseconds.
+func epochTime(number float64) time.Time {
+	switch {
+	case number > 1e17:
+		return time.Unix(0, int64(number))
+	case number > 1e14:
+		return time.Unix(0, int64(number*1e3))
+	case number > 1e11:
+		return time.Unix(0, int64(number*1e6))
+	default:
+		seconds := int64(number)
+		return time.Unix(seconds, int64((number-float64(seconds))*1e9))
+	}
+}
+
+func toString(value interface{}) string {
+	switch typed := value.(type) {
+	case string:
+		return typed
+	case nil:
+		return ""
+	default:
+		encoded, err := json.Marshal(typed)
+		if err != nil {
+			return ""
+		}
+		return string(encoded)
+	}
+}
@@ -0,0 +1,235 @@
+package process
+
+import (
+	"encoding/json"
+	"github.com/vvhq/exorsus/configuration"
+	"github.com/vvhq/exorsus/status"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		stream  string
+		line    string
+		level   string
+		message string
+		time    time.Time
+		fields  map[string]interface{}
+	}{
+		{
+			name:    "text stdout",
+			format:  configuration.LogFormatText,
+			stream:  status.StreamStdOut,
+			line:    `{"level":"error","msg":"kept as text"}`,
+			level:   status.LevelInfo,
+			message: `{"level":"error","msg":"kept as text"}`,
+		},
+		{
+			name:    "text stderr",
+			format:  "",
+			stream:  status.StreamStdErr,
+			line:    "failure",
+			level:   status.LevelError,
+			message: "failure",
+		},
+		{
+			name:    "json",
+			format:  configuration.LogFormatJSON,
+			stream:  status.StreamStdOut,
+			line:    `{"level":"WARN","msg":"disk low","time":"2024-05-06T07:08:09Z","free":12}`,
+			level:   status.LevelWarn,
+			message: "disk low",
+			time:    time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC),
+			fields:  map[string]interface{}{"free": json.Number("12")},
+		},
+		{
+			name:    "json numeric level and epoch millis",
+			format:  configuration.LogFormatJSON,
+			stream:  status.StreamStdOut,
+			line:    `{"level":50,"message":"crashed","ts":1714979289000}`,
+			level:   status.LevelError,
+			message: "crashed",
+			time:    time.Unix(1714979289, 0),
+		},
+		{
+			name:    "json without message",
+			format:  configuration.LogFormatJSON,
+			stream:  status.StreamStdOut,
+			line:    `{"event":"tick"}`,
+			level:   status.LevelInfo,
+			message: "",
+			fields:  map[string]interface{}{"event": "tick"},
+		},
+		{
+			name:    "json unparsable time kept as field",
+			format:  configuration.LogFormatJSON,
+			stream:  status.StreamStdOut,
+			line:    `{"msg":"m","time":"yesterday"}`,
+			level:   status.LevelInfo,
+			message: "m",
+			fields:  map[string]interface{}{"time": "yesterday"},
+		},
+		{
+			name:    "invalid json falls back to text",
+			format:  configuration.LogFormatJSON,
+			stream:  status.StreamStdErr,
+			line:    `{"level":`,
+			level:   status.LevelError,
+			message: `{"level":`,
+		},
+		{
+			name:    "logfmt",
+			format:  configuration.LogFormatLogfmt,
+			stream:  status.StreamStdOut,
+			line:    `level=debug msg="hello world" user=bob`,
+			level:   status.LevelDebug,
+			message: "hello world",
+			fields:  map[string]interface{}{"user": "bob"},
+		},
+		{
+			name:    "logfmt bare words become message",
+			format:  configuration.LogFormatLogfmt,
+			stream:  status.StreamStdOut,
+			line:    `started server port=8080`,
+			level:   status.LevelInfo,
+			message: "started server",
+			fields:  map[string]interface{}{"port": "8080"},
+		},
+		{
+			name:    "logfmt without pairs falls back to text",
+			format:  configuration.LogFormatLogfmt,
+			stream:  status.StreamStdOut,
+			line:    `just words`,
+			level:   status.LevelInfo,
+			message: "just words",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := time.Now()
+			item := parseLine(test.format, test.stream, test.line)
+			if item.Stream != test.stream {
+				t.Errorf("Stream = %q, want %q", item.Stream, test.stream)
+			}
+			if item.Line != test.line {
+				t.Errorf("Line = %q, want %q", item.Line, test.line)
+			}
+			if item.Level != test.level {
+				t.Errorf("Level = %q, want %q", item.Level, test.level)
+			}
+			if item.Message != test.message {
+				t.Errorf("Message = %q, want %q", item.Message, test.message)
+			}
+			if test.time.IsZero() {
+				if item.Time.Before(before) {
+					t.Errorf("Time = %v, want the time of capture", item.Time)
+				}
+			} else if !item.Time.Equal(test.time) {
+				t.Errorf("Time = %v, want %v", item.Time, test.time)
+			}
+			if !reflect.DeepEqual(item.Fields, test.fields) {
+				t.Errorf("Fields = %#v, want %#v", item.Fields, test.fields)
+			}
+		})
+	}
+}
+
+func TestParseLogfmt(t *testing.T) {
+	tests := []struct {
+		line   string
+		fields map[string]interface{}
+	}{
+		{`a=1 b=two`, map[string]interface{}{"a": "1", "b": "two"}},
+		{`a="quoted \"value\"" b=`, map[string]interface{}{"a": `quoted "value"`, "b": ""}},
+		{`  a=1   b=2  `, map[string]interface{}{"a": "1", "b": "2"}},
+		{`word a=1 other`, map[string]interface{}{"a": "1", "msg": "word other"}},
+		{`word msg=set`, map[string]interface{}{"msg": "set"}},
+		{`a="unterminated`, nil},
+		{`=value`, nil},
+		{`no pairs here`, nil},
+		{``, nil},
+	}
+	for _, test := range tests {
+		if fields := parseLogfmt(test.line); !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("parseLogfmt(%q) = %#v, want %#v", test.line, fields, test.fields)
+		}
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		line   string
+		fields map[string]interface{}
+	}{
+		{` {"a":"b"} `, map[string]interface{}{"a": "b"}},
+		{`{"n":1.5}`, map[string]interface{}{"n": json.Number("1.5")}},
+		{`["not","an","object"]`, nil},
+		{`plain`, nil},
+		{`{"broken"`, nil},
+	}
+	for _, test := range tests {
+		if fields := parseJSON(test.line); !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("parseJSON(%q) = %#v, want %#v", test.line, fields, test.fields)
+		}
+	}
+}
+
+func TestNormalizeLevel(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{"TRACE", status.LevelTrace},
+		{"dbug", status.LevelDebug},
+		{"Notice", status.LevelInfo},
+		{"warning", status.LevelWarn},
+		{"ERR", status.LevelError},
+		{"crit", status.LevelFatal},
+		{"unknown", "fallback"},
+		{json.Number("10"), status.LevelTrace},
+		{json.Number("20"), status.LevelDebug},
+		{json.Number("30"), status.LevelInfo},
+		{json.Number("40"), status.LevelWarn},
+		{json.Number("50"), status.LevelError},
+		{json.Number("60"), status.LevelFatal},
+		{json.Number("4.5"), "fallback"},
+		{true, "fallback"},
+	}
+	for _, test := range tests {
+		if got := normalizeLevel(test.value, "fallback"); got != test.want {
+			t.Errorf("normalizeLevel(%#v) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	base := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	tests := []struct {
+		value interface{}
+		want  time.Time
+		ok    bool
+	}{
+		{"2024-05-06T07:08:09Z", base, true},
+		{"2024-05-06T07:08:09.5+02:00", base.Add(-2*time.Hour + 500*time.Millisecond), true},
+		{"2024-05-06 07:08:09Z", base, true},
+		{"2024-05-06T07:08:09", base, true},
+		{"2024-05-06 07:08:09.25", base.Add(250 * time.Millisecond), true},
+		{"1714979289", base, true},
+		{json.Number("1714979289.5"), base.Add(500 * time.Millisecond), true},
+		{json.Number("1714979289000"), base, true},
+		{json.Number("1714979289000000"), base, true},
+		{json.Number("1714979289000000000"), base, true},
+		{"noon", time.Time{}, false},
+		{false, time.Time{}, false},
+	}
+	for _, test := range tests {
+		got, ok := parseTime(test.value)
+		if ok != test.ok || (ok && !got.Equal(test.want)) {
+			t.Errorf("parseTime(%#v) = %v, %v, want %v, %v", test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
@@ -0,0 +1,685 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"github.com/vvhq/exorsus/configuration"
+	"github.com/vvhq/exorsus/events"
+	"github.com/vvhq/exorsus/status"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const actionClose string = "close"
+const actionSignal string = "signal"
+
+// outputDrainTimeout bounds the wait for the output of an exited process,
+// whose pipes may be kept open by its children.
+const outputDrainTimeout time.Duration = time.Second
+
+// allowedTransitions lists the states each state may move to. Starting may
+// end in Stopped when the command can not be executed; Failed means the
+// process survived SIGKILL and stays until it exits or is stopped again.
+var allowedTransitions = map[int][]int{
+	status.Stopped:  {status.Starting},
+	status.Starting: {status.Started, status.Stopped},
+	status.Started:  {status.Stopping, status.Stopped},
+	status.Stopping: {status.Stopped, status.Failed},
+	status.Failed:   {status.Stopping, status.Stopped},
+}
+
+// stateEvents names the event published when a state is entered.
+var stateEvents = map[int]string{
+	status.Starting: events.TypeStarting,
+	status.Started:  events.TypeStarted,
+	status.Stopping: events.TypeStopping,
+	status.Stopped:  events.TypeExited,
+	status.Failed:   events.TypeFailed,
+}
+
+type command struct {
+	action string
+	signal syscall.Signal
+	result chan error
+}
+
+// machine holds the state owned by the run goroutine of a process.
+type machine struct {
+	running bool
+	restart bool
+	closing bool
+	kill    *time.Timer
+	stable  *time.Timer
+	crashes []time.Time
+	// signaled is when an operator last sent a terminating signal; an exit
+	// within the stop timeout after it is not counted as a crash.
+	signaled time.Time
+	// launching is the launch waiting for its pre start command, which is
+	// cancelled by prestart; aborted drops the launch once it finished.
+	launching *launching
+	prestart  context.CancelFunc
+	aborted   bool
+}
+
+// launching holds what a launch prepared for the command while its pre start
+// command runs.
+type launching struct {
+	listener     *listener
+	stdInReader  *os.File
+	stdOutWriter *os.File
+	stdErrWriter *os.File
+	output       *sync.WaitGroup
+}
+
+// send hands the action to the run goroutine and returns its verdict, which
+// is given before any slow work such as a pre start command is done.
+func (process *Process) send(action string) error {
+	return process.submit(command{action: action})
+}
+
+func (process *Process) submit(cmd command) error {
+	cmd.result = make(chan error, 1)
+	select {
+	case process.commands <- cmd:
+		return <-cmd.result
+	case <-process.done:
+		return ErrClosed
+	}
+}
+
+// close stops the run goroutine once the process is not running anymore.
+func (process *Process) close() {
+	_ = process.send(actionClose)
+}
+
+// run is the only goroutine which changes the state of the process, so each
+// action sees the state left by the previous one.
+func (process *Process) run() {
+	for {
+		var kill <-chan time.Time
+		if process.machine.kill != nil {
+			kill = process.machine.kill.C
+		}
+		var stable <-chan time.Time
+		if process.machine.stable != nil {
+			stable = process.machine.stable.C
+		}
+		select {
+		case cmd := <-process.commands:
+			process.handle(cmd)
+		case err := <-process.exited:
+			process.exit(err)
+		case <-process.prestartDone:
+			process.prestarted()
+		case <-kill:
+			process.machine.kill = nil
+			process.forceKill()
+		case <-stable:
+			process.machine.stable = nil
+			process.crashLoop(false)
+		}
+		if process.machine.closing && !process.machine.running && process.machine.launching == nil {
+			if process.subscription != nil {
+				process.bus.Unsubscribe(process.subscription)
+			}
+			close(process.done)
+			return
+		}
+	}
+}
+
+func (process *Process) handle(cmd command) {
+	state := process.status.GetState()
+	switch cmd.action {
+	case ActionStart:
+		switch state {
+		case status.Started:
+			cmd.result <- ErrAlreadyStarted
+		case status.Stopped:
+			if !process.starting() {
+				cmd.result <- ErrBusy
+				return
+			}
+			cmd.result <- nil
+			process.launch()
+		default:
+			cmd.result <- ErrBusy
+		}
+	case ActionStop:
+		switch state {
+		case status.Stopped:
+			cmd.result <- ErrAlreadyStopped
+		case status.Started, status.Failed:
+			cmd.result <- nil
+			process.machine.restart = false
+			process.interrupt(state)
+		case status.Starting:
+			if process.machine.launching == nil {
+				cmd.result <- ErrBusy
+				return
+			}
+			cmd.result <- nil
+			process.machine.restart = false
+			process.abort()
+		default:
+			cmd.result <- ErrBusy
+		}
+	case ActionRestart:
+		switch state {
+		case status.Stopped:
+			if !process.starting() {
+				cmd.result <- ErrBusy
+				return
+			}
+			cmd.result <- nil
+			process.launch()
+		case status.Started:
+			cmd.result <- nil
+			process.machine.restart = true
+			process.interrupt(state)
+		default:
+			cmd.result <- ErrBusy
+		}
+	case actionSignal:
+		if !process.machine.running {
+			cmd.result <- ErrNotRunning
+			return
+		}
+		err := process.kill(cmd.signal)
+		cmd.result <- err
+		if err != nil {
+			process.logger.
+				WithField("source", "process").
+				WithField("process", process.Name).
+				WithField("state", process.GetState()).
+				WithField("signal", SignalName(cmd.signal)).
+				WithField("error", err.Error()).
+				Error("Can not signal process")
+			return
+		}
+		if terminating(cmd.signal) {
+			process.machine.signaled = time.Now()
+		}
+		process.publishMessage(events.TypeSignaled, SignalName(cmd.signal))
+		process.logger.
+			WithField("source", "process").
+			WithField("process", process.Name).
+			WithField("state", process.GetState()).
+			WithField("signal", SignalName(cmd.signal)).
+			Info("Process signaled")
+	case actionClose:
+		process.machine.closing = true
+		process.machine.restart = false
+		if process.machine.launching != nil {
+			process.abort()
+		}
+		cmd.result <- nil
+	default:
+		cmd.result <- ErrUnknownAction
+	}
+}
+
+// transition moves the process from one state to another when the move is
+// allowed and the process is still in the expected state.
+func (process *Process) transition(from int, to int) bool {
+	allowed := false
+	for _, state := range allowedTransitions[from] {
+		if state == to {
+			allowed = true
+		}
+	}
+	if allowed && process.status.CompareAndSwapState(from, to) {
+		if from == status.Starting && to == status.Stopped {
+			process.publish(events.TypeFailed)
+		} else {
+			process.publish(stateEvents[to])
+		}
+		return true
+	}
+	process.logger.
+		WithField("source", "process").
+		WithField("process", process.Name).
+		WithField("state", process.GetState()).
+		WithField("from", StateName(from)).
+		WithField("to", StateName(to)).
+		Error("Invalid state transition")
+	return false
+}
+
+func (process *Process) publish(eventType string) {
+	process.publishMessage(eventType, "")
+}
+
+func (process *Process) publishMessage(eventType string, message string) {
+	event := events.Event{
+		Type:        eventType,
+		Application: process.Name,
+		State:       StateName(process.GetState()),
+		Pid:         process.GetPid(),
+		Code:        process.GetExitCode(),
+		Message:     message}
+	if err := process.GetError(); err != nil {
+		event.Error = err.Error()
+	}
+	process.bus.Publish(event)
+}
+
+// starting clears the result of the previous run and enters Starting.
+func (process *Process) starting() bool {
+	process.status.SetPid(0)
+	process.status.SetExitCode(0)
+	process.status.SetError(nil)
+	return process.transition(status.Stopped, status.Starting)
+}
+
+// environment returns the environment of exorsus with the variables of the
+// application added.
+func (process *Process) environment() []string {
+	environment := os.Environ()
+	for _, env := range process.app.Environment {
+		environment = append(environment, fmt.Sprintf("%s=%s", env.Name, env.Value))
+	}
+	return environment
+}
+
+// launch prepares the command of a process in the Starting state and starts
+// it, once its pre start command finished when it has one.
+func (process *Process) launch() {
+	arguments := strings.Fields(strings.TrimSpace(process.app.Arguments))
+
+	process.command = exec.Command(process.app.Command, arguments...)
+	process.command.Dir = process.app.WorkDir
+
+	if process.findCredential() != nil {
+		process.logger.
+			WithField("source", "process").
+			WithField("process", process.Name).
+			WithField("state", process.GetState()).
+			WithField("user", process.app.User).
+			WithField("group", process.app.Group).
+			Trace("Start process as specific user/group")
+		process.command.SysProcAttr = &syscall.SysProcAttr{}
+		process.command.SysProcAttr.Credential = process.findCredential()
+	}
+	if process.app.ProcessGroup {
+		if process.command.SysProcAttr == nil {
+			process.command.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		process.command.SysProcAttr.Setpgid = true
+	}
+	var tty *terminal
+	var ttySlave *os.File
+	if process.TtyEnabled() {
+		tty, ttySlave = process.openTerminal()
+	}
+	if tty != nil {
+		if process.command.SysProcAttr == nil {
+			process.command.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		ttyAttributes(process.command.SysProcAttr)
+	}
+
+	process.command.Env = process.environment()
+
+	var eventListener *listener
+	var control func(string) bool
+	var stdInReader *os.File
+	if process.subscription != nil {
+		eventListener, stdInReader = process.newListener()
+		if eventListener != nil {
+			process.command.Stdin = stdInReader
+			control = eventListener.handle
+		}
+	} else if process.StdinEnabled() {
+		stdInReader = process.openStdin()
+		if stdInReader != nil {
+			process.command.Stdin = stdInReader
+		}
+	}
+
+	output := &sync.WaitGroup{}
+	stdOutChan := make(chan string, 4096)
+	stdErrChan := make(chan string, 4096)
+	var stdOutWriter *os.File
+	var stdErrWriter *os.File
+	if tty != nil {
+		// Everything written to the terminal is captured as stdout.
+		process.command.Stdin = ttySlave
+		process.command.Stdout = ttySlave
+		process.command.Stderr = ttySlave
+		process.pipe2Channel(tty, stdOutChan)
+		process.stdOutChannelHandler(stdOutChan, output, control)
+		stdOutWriter = ttySlave
+	} else {
+		stdOutWriter = process.pipe(stdOutChan, "stdout")
+		if stdOutWriter != nil {
+			process.command.Stdout = stdOutWriter
+			process.stdOutChannelHandler(stdOutChan, output, control)
+		}
+		stdErrWriter = process.pipe(stdErrChan, "stderr")
+		if stdErrWriter != nil {
+			process.command.Stderr = stdErrWriter
+			process.stdErrChannelHandler(stdErrChan, output)
+		}
+	}
+
+	pending := &launching{
+		listener:     eventListener,
+		stdInReader:  stdInReader,
+		stdOutWriter: stdOutWriter,
+		stdErrWriter: stdErrWriter,
+		output:       output}
+	if process.app.PreStart.Command == "" {
+		process.spawn(pending)
+		return
+	}
+	// The pre start command runs off the run goroutine, so the process can
+	// still be stopped or closed meanwhile; spawn follows once it finished.
+	if stdOutWriter == nil {
+		stdOutChan = nil
+	}
+	preContext, preCancel := context.WithCancel(context.Background())
+	process.machine.launching = pending
+	process.machine.prestart = preCancel
+	process.machine.aborted = false
+	go func() {
+		process.preStart(preContext, stdOutChan)
+		process.prestartDone <- struct{}{}
+	}()
+}
+
+// prestarted continues the launch once its pre start command finished, or
+// drops it when the launch was aborted meanwhile.
+func (process *Process) prestarted() {
+	pending := process.machine.launching
+	process.machine.prestart()
+	process.machine.launching = nil
+	process.machine.prestart = nil
+	if process.machine.aborted {
+		process.machine.aborted = false
+		process.release(pending)
+		process.status.SetError(nil)
+		process.transition(status.Starting, status.Stopped)
+		process.logger.
+			WithField("source", "process").
+			WithField("process", process.Name).
+			WithField("state", process.GetState()).
+			Info("Process start aborted")
+		return
+	}
+	process.spawn(pending)
+}
+
+// abort kills the running pre start command and drops its launch.
+func (process *Process) abort() {
+	process.machine.aborted = true
+	process.machine.prestart()
+}
+
+// release closes what a launch prepared when the command is not started.
+func (process *Process) release(pending *launching) {
+	for _, file := range []*os.File{pending.stdOutWriter, pending.stdErrWriter, pending.stdInReader} {
+		if file != nil {
+			_ = file.Close()
+		}
+	}
+	if pending.listener != nil {
+		close(pending.listener.stop)
+		_ = pending.listener.stdin.Close()
+	}
+	process.releaseStdin()
+	process.releaseTerminal()
+}
+
+// spawn starts the command prepared by launch.
+func (process *Process) spawn(pending *launching) {
+	eventListener := pending.listener
+	stdInReader := pending.stdInReader
+	stdOutWriter := pending.stdOutWriter
+	stdErrWriter := pending.stdErrWriter
+	output := pending.output
+
+	process.logger.
+		WithField("source", "process").
+		WithField("path", process.command.Path).
+		WithField("dir", process.command.Dir).
+		WithField("args", process.command.Args).
+		Trace("About to start command")
+
+	err := process.command.Start()
+	// The child has its own copies now; readers see EOF once it is gone.
+	if stdOutWriter != nil {
+		_ = stdOutWriter.Close()
+	}
+	if stdErrWriter != nil {
+		_ = stdErrWriter.Close()
+	}
+	if stdInReader != nil {
+		_ = stdInReader.Close()
+	}
+	if err != nil {
+		if eventListener != nil {
+			close(eventListener.stop)
+			_ = eventListener.stdin.Close()
+		}
+		process.releaseStdin()
+		process.releaseTerminal()
+		process.status.SetError(err)
+		process.status.SetExitCode(-1)
+		process.transition(status.Starting, status.Stopped)
+		process.logger.
+			WithField("source", "process").
+			WithField("process", process.Name).
+			WithField("state", process.GetState()).
+			WithField("error", err.Error()).
+			Error("Can not start process")
+		return
+	}
+	process.status.SetPid(process.getCurrentPid())
+	process.status.SetStartTime(time.Now())
+	process.machine.running = true
+	process.mainWaitGroup.Add(1)
+	if eventListener != nil {
+		process.mainWaitGroup.Add(1)
+		go eventListener.serve()
+	}
+	go func(command *exec.Cmd) {
+		err := command.Wait()
+		if eventListener != nil {
+			close(eventListener.stop)
+		}
+		drained := make(chan struct{})
+		go func() {
+			output.Wait()
+			close(drained)
+		}()
+		select {
+		case <-drained:
+		case <-time.After(outputDrainTimeout):
+		}
+		process.exited <- err
+	}(process.command)
+	process.transition(status.Starting, status.Started)
+	if process.status.CrashLoop() {
+		process.machine.stable = time.NewTimer(process.config.GetCrashLoopWindow())
+	}
+}
+
+// crashed reports an unexpected failed exit, and a crash loop once the
+// process crashed CrashLoopCount times within CrashLoopWindow.
+func (process *Process) crashed() {
+	process.publish(events.TypeCrashed)
+	now := time.Now()
+	window := now.Add(-process.config.GetCrashLoopWindow())
+	recent := process.machine.crashes[:0]
+	for _, crash := range process.machine.crashes {
+		if crash.After(window) {
+			recent = append(recent, crash)
+		}
+	}
+	process.machine.crashes = append(recent, now)
+	if len(process.machine.crashes) >= process.config.GetCrashLoopCount() {
+		process.machine.crashes = nil
+		process.publish(events.TypeCrashLoop)
+		process.logger.
+			WithField("source", "process").
+			WithField("process", process.Name).
+			WithField("state", process.GetState()).
+			Error("Process is crash looping")
+		process.crashLoop(true)
+	}
+}
+
+// crashLoop marks or clears the crash loop of the process; the mark is
+// cleared by a clean exit, a requested stop or a run lasting CrashLoopWindow.
+func (process *Process) crashLoop(crashLoop bool) {
+	if !process.status.SetCrashLoop(crashLoop) {
+		return
+	}
+	if crashLoop {
+		process.publishMessage(events.TypeHealthChanged, "unhealthy")
+	} else {
+		process.publishMessage(events.TypeHealthChanged, "healthy")
+	}
+}
+
+// pipe connects the channel to a new pipe and returns its write end, or nil
+// (with the channel closed) when the pipe can not be created.
+func (process *Process) pipe(channel chan string, stream string) *os.File {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		close(channel)
+		process.logger.
+			WithField("source", "process").
+			WithField("process", process.Name).
+			WithField("state", process.GetState()).
+			WithField("error", err.Error()).
+			Errorf("Can not create %s pipe", stream)
+		return nil
+	}
+	process.pipe2Channel(reader, channel)
+	return writer
+}
+
+// interrupt asks a started (or failed) process to stop and arms the timer
+// which kills it when it does not exit in time.
+func (process *Process) interrupt(from int) {
+	if !process.transition(from, status.Stopping) {
+		return
+	}
+	process.status.SetError(nil)
+	err := process.kill(syscall.SIGINT)
+	if err != nil {
+		process.logger.
+			WithField("source", "process").
+			WithField("process", process.Name).
+			WithField("state", process.GetState()).
+			WithField("pid", fmt.Sprintf("%d", process.status.GetPid())).
+			WithField("error", err.Error()).
+			Error("Can not gracefully stop process")
+	}
+	process.machine.kill = time.NewTimer(process.stopTimeout())
+}
+
+// stopTimeout is how long the process may take to exit after being asked to.
+func (process *Process) stopTimeout() time.Duration {
+	timeout := process.app.Timeout
+	if timeout <= 0 {
+		timeout = configuration.DefaultShutdownTimeout
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+func (process *Process) forceKill() {
+	if !process.machine.running || process.status.GetState() != status.Stopping {
+		return
+	}
+	err := process.kill(syscall.SIGKILL)
+	if err == nil {
+		process.publish(events.TypeKilled)
+		process.logger.
+			WithField("source", "process").
+			WithField("process", process.Name).
+			WithField("state", process.GetState()).
+			WithField("pid", fmt.Sprintf("%d", process.status.GetPid())).
+			Warn("Process killed after stop timeout")
+		return
+	}
+	process.status.SetError(err)
+	process.transition(status.Stopping, status.Failed)
+	process.logger.
+		WithField("source", "process").
+		WithField("process", process.Name).
+		WithField("state", process.GetState()).
+		WithField("pid", fmt.Sprintf("%d", process.status.GetPid())).
+		WithField("error", err.Error()).
+		Error("Can not KILL process")
+}
+
+// exit records the result of a finished process and starts it again when
+// the exit was part of a restart. An exit within the stop timeout after a
+// terminating signal sent by an operator is requested like a stop.
+func (process *Process) exit(err error) {
+	process.machine.running = false
+	requested := !process.machine.signaled.IsZero() && time.Since(process.machine.signaled) <= process.stopTimeout()
+	process.machine.signaled = time.Time{}
+	process.releaseStdin()
+	process.releaseTerminal()
+	process.mainWaitGroup.Done()
+	if process.machine.kill != nil {
+		process.machine.kill.Stop()
+		process.machine.kill = nil
+	}
+	if process.machine.stable != nil {
+		process.machine.stable.Stop()
+		process.machine.stable = nil
+	}
+	state := process.status.GetState()
+	process.status.SetExitCode(0)
+	if err != nil {
+		process.status.SetExitCode(-1)
+		exitError, ok := err.(*exec.ExitError)
+		if ok {
+			exitStatus, ok := exitError.Sys().(syscall.WaitStatus)
+			if ok {
+				process.status.SetExitCode(exitStatus.ExitStatus())
+			}
+		}
+	}
+	if state == status.Started && !requested {
+		process.status.SetError(err)
+		if err != nil {
+			process.logger.
+				WithField("source", "process").
+				WithField("process", process.Name).
+				WithField("state", state).
+				WithField("error", err.Error()).
+				Error("Error waiting for process")
+		}
+	} else {
+		process.status.SetError(nil)
+	}
+	process.transition(state, status.Stopped)
+	if state == status.Started && err != nil && !requested {
+		process.crashed()
+	} else {
+		process.crashLoop(false)
+	}
+	process.logger.
+		WithField("source", "process").
+		WithField("process", process.Name).
+		WithField("state", process.GetState()).
+		WithField("pid", fmt.Sprintf("%d", process.status.GetPid())).
+		WithField("code", fmt.Sprintf("%d", process.status.GetExitCode())).
+		Trace("Process stopped")
+	if process.machine.restart {
+		process.machine.restart = false
+		if process.starting() {
+			process.launch()
+		}
+	}
+}
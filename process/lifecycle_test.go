@@ -0,0 +1,175 @@
+package process
+
+import (
+	"github.com/vvhq/exorsus/application"
+	"github.com/vvhq/exorsus/events"
+	"github.com/vvhq/exorsus/status"
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func waitState(t *testing.T, proc *Process, state int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for proc.GetState() != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("state = %d, want %d", proc.GetState(), state)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPreStart(t *testing.T) {
+	proc := testProcess(t, application.Application{
+		Name:      "prestart",
+		Command:   "/bin/sleep",
+		Arguments: "30",
+		PreStart:  application.PreStart{Command: "/bin/sleep", Arguments: "0.2", Timeout: 5}})
+
+	if err := proc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if state := proc.GetState(); state != status.Starting {
+		t.Fatalf("state = %d while the pre start command runs, want %d", state, status.Starting)
+	}
+	waitState(t, proc, status.Started)
+}
+
+func TestPreStartStop(t *testing.T) {
+	proc := testProcess(t, application.Application{
+		Name:      "prestart",
+		Command:   "/bin/sleep",
+		Arguments: "30",
+		PreStart:  application.PreStart{Command: "/bin/sleep", Arguments: "30", Timeout: 60}})
+
+	if err := proc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	started := time.Now()
+	if err := proc.Stop(); err != nil {
+		t.Fatalf("stop while the pre start command runs: %v", err)
+	}
+	waitState(t, proc, status.Stopped)
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("stop took %s, want the pre start command killed", elapsed)
+	}
+	if pid := proc.status.GetPid(); pid != 0 {
+		t.Errorf("pid = %d, want the command never started", pid)
+	}
+}
+
+func TestSignalExit(t *testing.T) {
+	tests := []struct {
+		name    string
+		signal  func(proc *Process) error
+		crashed bool
+	}{
+		{"operator TERM", func(proc *Process) error { return proc.Signal(syscall.SIGTERM) }, false},
+		{"operator KILL", func(proc *Process) error { return proc.Signal(syscall.SIGKILL) }, false},
+		{"external TERM", func(proc *Process) error { return syscall.Kill(proc.status.GetPid(), syscall.SIGTERM) }, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proc := testProcess(t, application.Application{Name: "signaled", Command: "/bin/sleep", Arguments: "30"})
+			subscription, _ := proc.bus.Subscribe(events.Filter{Types: []string{events.TypeCrashed}}, 0)
+			if err := proc.Start(); err != nil {
+				t.Fatal(err)
+			}
+			waitState(t, proc, status.Started)
+			if err := test.signal(proc); err != nil {
+				t.Fatal(err)
+			}
+			waitState(t, proc, status.Stopped)
+			crashed := false
+			select {
+			case <-subscription.C:
+				crashed = true
+			case <-time.After(200 * time.Millisecond):
+			}
+			if crashed != test.crashed {
+				t.Errorf("crashed = %v, want %v", crashed, test.crashed)
+			}
+			if err := proc.Start(); err != nil {
+				t.Fatal(err)
+			}
+			waitState(t, proc, status.Started)
+			if err := syscall.Kill(proc.status.GetPid(), syscall.SIGTERM); err != nil {
+				t.Fatal(err)
+			}
+			waitState(t, proc, status.Stopped)
+			select {
+			case <-subscription.C:
+			case <-time.After(time.Second):
+				t.Error("the next unexpected exit is not a crash")
+			}
+		})
+	}
+}
+
+func TestSignalIgnored(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "ignore.sh")
+	err := ioutil.WriteFile(script, []byte("trap '' TERM\necho ready\nwhile true; do sleep 0.1; done\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc := testProcess(t, application.Application{Name: "ignore", Command: "/bin/sh", Arguments: script, Timeout: 1})
+	subscription, _ := proc.bus.Subscribe(events.Filter{Types: []string{events.TypeCrashed}}, 0)
+	if err := proc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for proc.status.StdOutLen() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("process did not get ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := proc.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	// The process outlives the stop timeout, so its later death is a crash.
+	time.Sleep(1500 * time.Millisecond)
+	if state := proc.GetState(); state != status.Started {
+		t.Fatalf("state = %d after the ignored signal, want %d", state, status.Started)
+	}
+	if err := syscall.Kill(proc.status.GetPid(), syscall.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, proc, status.Stopped)
+	select {
+	case <-subscription.C:
+	case <-time.After(time.Second):
+		t.Error("the exit long after the ignored signal is not a crash")
+	}
+}
+
+func TestPreStartEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "prestart.sh")
+	output := filepath.Join(dir, "environment")
+	err := ioutil.WriteFile(script, []byte("echo \"$FIRST $SECOND\" > "+output+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc := testProcess(t, application.Application{
+		Name:        "prestart",
+		Command:     "/bin/sleep",
+		Arguments:   "30",
+		Environment: []application.Environment{{Name: "FIRST", Value: "one"}, {Name: "SECOND", Value: "two"}},
+		PreStart:    application.PreStart{Command: "/bin/sh", Arguments: script, Timeout: 5}})
+
+	if err := proc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, proc, status.Started)
+	environment, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(environment) != "one two\n" {
+		t.Errorf("pre start environment = %q, want every application variable", environment)
+	}
+}
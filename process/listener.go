@@ -0,0 +1,126 @@
+package process
+
+import (
+	"encoding/json"
+	"github.com/vvhq/exorsus/events"
+	"os"
+	"strings"
+)
+
+const listenerReady string = "READY"
+const listenerOK string = "OK"
+const listenerFail string = "FAIL"
+
+// listener serves events to one run of an event listener application.
+type listener struct {
+	process *Process
+	stdin   *os.File
+	control chan string
+	stop    chan struct{}
+}
+
+// handle takes protocol lines out of the stdout of the listener; other
+// lines are captured as usual.
+func (listener *listener) handle(line string) bool {
+	token := strings.TrimSpace(line)
+	if token != listenerReady && token != listenerOK && token != listenerFail {
+		return false
+	}
+	select {
+	case listener.control <- token:
+	case <-listener.stop:
+	}
+	return true
+}
+
+// await waits for one of the tokens and returns it, or "" when the run ended.
+func (listener *listener) await(tokens ...string) string {
+	for {
+		select {
+		case token := <-listener.control:
+			for _, expected := range tokens {
+				if token == expected {
+					return token
+				}
+			}
+			listener.process.logger.
+				WithField("source", "listener").
+				WithField("process", listener.process.Name).
+				WithField("token", token).
+				Warn("Unexpected event listener token")
+		case <-listener.stop:
+			return ""
+		}
+	}
+}
+
+func (listener *listener) serve() {
+	process := listener.process
+	defer process.mainWaitGroup.Done()
+	defer listener.stdin.Close()
+	var pending *events.Event
+	defer func() {
+		if pending != nil {
+			select {
+			case process.redeliver <- *pending:
+			default:
+			}
+		}
+	}()
+	for {
+		if listener.await(listenerReady) == "" {
+			return
+		}
+		if pending == nil {
+			select {
+			case event := <-process.redeliver:
+				pending = &event
+			case event := <-process.subscription.C:
+				pending = &event
+			case <-listener.stop:
+				return
+			}
+		}
+		line, err := json.Marshal(pending)
+		if err != nil {
+			pending = nil
+			continue
+		}
+		_, err = listener.stdin.Write(append(line, '\n'))
+		if err != nil {
+			process.logger.
+				WithField("source", "listener").
+				WithField("process", process.Name).
+				WithField("error", err.Error()).
+				Error("Can not write event to listener")
+			return
+		}
+		switch listener.await(listenerOK, listenerFail) {
+		case listenerOK:
+			pending = nil
+		case listenerFail:
+			process.logger.
+				WithField("source", "listener").
+				WithField("process", process.Name).
+				WithField("event", pending.ID).
+				Warn("Event listener failed to handle event, it will be sent again")
+		default:
+			return
+		}
+	}
+}
+
+// newListener connects a pipe to the stdin of the command and starts serving
+// events once the command runs; it returns nil when the pipe can not be made.
+func (process *Process) newListener() (*listener, *os.File) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		process.logger.
+			WithField("source", "listener").
+			WithField("process", process.Name).
+			WithField("error", err.Error()).
+			Error("Can not create stdin pipe")
+		return nil, nil
+	}
+	return &listener{process: process, stdin: writer, control: make(chan string, 16), stop: make(chan struct{})}, reader
+}
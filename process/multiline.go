@@ -0,0 +1,114 @@
+package process
+
+import (
+	"github.com/vvhq/exorsus/application"
+	"github.com/vvhq/exorsus/configuration"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type joiner struct {
+	pattern  *regexp.Regexp
+	indent   bool
+	maxLines int
+	timeout  time.Duration
+	pending  []string
+}
+
+func (joiner *joiner) continues(line string) bool {
+	if joiner.indent && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+		return true
+	}
+	return joiner.pattern != nil && !joiner.pattern.MatchString(line)
+}
+
+// add buffers the line and returns the previous entry once the line starts a new one.
+func (joiner *joiner) add(line string) (string, bool) {
+	if len(joiner.pending) > 0 && joiner.continues(line) && len(joiner.pending) < joiner.maxLines {
+		joiner.pending = append(joiner.pending, line)
+		return "", false
+	}
+	entry, ok := joiner.flush()
+	joiner.pending = append(joiner.pending, line)
+	return entry, ok
+}
+
+func (joiner *joiner) flush() (string, bool) {
+	if len(joiner.pending) == 0 {
+		return "", false
+	}
+	entry := strings.Join(joiner.pending, "\n")
+	joiner.pending = joiner.pending[:0]
+	return entry, true
+}
+
+func newJoiner(multiline application.Multiline) (*joiner, error) {
+	if multiline.Pattern == "" && !multiline.Indent {
+		return nil, nil
+	}
+	joiner := &joiner{
+		indent:   multiline.Indent,
+		maxLines: multiline.MaxLines,
+		timeout:  time.Duration(multiline.FlushTimeout) * time.Millisecond}
+	if multiline.Pattern != "" {
+		pattern, err := regexp.Compile(multiline.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		joiner.pattern = pattern
+	}
+	if joiner.maxLines <= 0 {
+		joiner.maxLines = configuration.DefaultMultilineMaxLines
+	}
+	if joiner.timeout <= 0 {
+		joiner.timeout = time.Duration(configuration.DefaultMultilineFlushTimeout) * time.Millisecond
+	}
+	return joiner, nil
+}
+
+// collect passes every complete entry read from the channel to handle,
+// joining continuation lines according to the application multiline rules.
+func (process *Process) collect(channel <-chan string, handle func(string)) {
+	joiner, err := newJoiner(process.app.Multiline)
+	if err != nil {
+		process.logger.
+			WithField("source", "process").
+			WithField("process", process.Name).
+			WithField("error", err.Error()).
+			Error("Invalid multiline pattern, lines will not be joined")
+	}
+	if joiner == nil {
+		for line := range channel {
+			handle(line)
+		}
+		return
+	}
+	timer := time.NewTimer(joiner.timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case line, ok := <-channel:
+			if !ok {
+				if entry, ok := joiner.flush(); ok {
+					handle(entry)
+				}
+				return
+			}
+			if entry, ok := joiner.add(line); ok {
+				handle(entry)
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(joiner.timeout)
+		case <-timer.C:
+			if entry, ok := joiner.flush(); ok {
+				handle(entry)
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package process
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/vvhq/exorsus/application"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func joinLines(t *testing.T, multiline application.Multiline, lines []string) []string {
+	t.Helper()
+	joiner, err := newJoiner(multiline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []string
+	for _, line := range lines {
+		if entry, ok := joiner.add(line); ok {
+			entries = append(entries, entry)
+		}
+	}
+	if entry, ok := joiner.flush(); ok {
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestJoiner(t *testing.T) {
+	tests := []struct {
+		name      string
+		multiline application.Multiline
+		lines     []string
+		entries   []string
+	}{
+		{
+			name:      "indented java stack trace",
+			multiline: application.Multiline{Indent: true},
+			lines:     []string{"Exception in thread", "\tat A.b(A.java:1)", "    at C.d(C.java:2)", "next"},
+			entries:   []string{"Exception in thread\n\tat A.b(A.java:1)\n    at C.d(C.java:2)", "next"},
+		},
+		{
+			name:      "pattern starts entries",
+			multiline: application.Multiline{Pattern: `^\d{4}-`},
+			lines:     []string{"2024-01-01 first", "Traceback:", "  File x", "2024-01-02 second"},
+			entries:   []string{"2024-01-01 first\nTraceback:\n  File x", "2024-01-02 second"},
+		},
+		{
+			name:      "leading continuation stands alone",
+			multiline: application.Multiline{Indent: true},
+			lines:     []string{"  orphan", "head", " tail"},
+			entries:   []string{"  orphan", "head\n tail"},
+		},
+		{
+			name:      "max lines splits",
+			multiline: application.Multiline{Indent: true, MaxLines: 2},
+			lines:     []string{"head", " one", " two", " three"},
+			entries:   []string{"head\n one", " two\n three"},
+		},
+		{
+			name:      "no continuation",
+			multiline: application.Multiline{Pattern: `^\S`},
+			lines:     []string{"a", "b"},
+			entries:   []string{"a", "b"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if entries := joinLines(t, test.multiline, test.lines); !reflect.DeepEqual(entries, test.entries) {
+				t.Errorf("entries = %q, want %q", entries, test.entries)
+			}
+		})
+	}
+}
+
+func TestNewJoiner(t *testing.T) {
+	joiner, err := newJoiner(application.Multiline{})
+	if joiner != nil || err != nil {
+		t.Errorf("newJoiner without rules = %v, %v, want nil, nil", joiner, err)
+	}
+	if _, err := newJoiner(application.Multiline{Pattern: "("}); err == nil {
+		t.Error("newJoiner with invalid pattern succeeded")
+	}
+}
+
+func TestCollectFlushTimeout(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	process := &Process{Name: "test", app: &application.Application{Multiline: application.Multiline{Indent: true, FlushTimeout: 20}}, logger: logger}
+	channel := make(chan string)
+	entries := make(chan string, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		process.collect(channel, func(entry string) {
+			entries <- entry
+		})
+	}()
+	channel <- "head"
+	channel <- " tail"
+	select {
+	case entry := <-entries:
+		if entry != "head\n tail" {
+			t.Errorf("entry = %q, want %q", entry, "head\n tail")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pending entry was not flushed after the timeout")
+	}
+	channel <- "last"
+	close(channel)
+	<-done
+	if entry := <-entries; entry != "last" {
+		t.Errorf("entry = %q, want %q", entry, "last")
+	}
+}
@@ -0,0 +1,222 @@
+package process
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+)
+
+const OperationRunning string = "running"
+const OperationSucceeded string = "succeeded"
+const OperationFailed string = "failed"
+const OperationRejected string = "rejected"
+const OperationTimeout string = "timeout"
+
+type Progress struct {
+	Application string     `json:"application"`
+	Status      string     `json:"status"`
+	State       string     `json:"state"`
+	Error       string     `json:"error,omitempty"`
+	Started     time.Time  `json:"started"`
+	Finished    *time.Time `json:"finished,omitempty"`
+}
+
+// OperationStatus is the state of an operation as reported by the API.
+type OperationStatus struct {
+	ID           string      `json:"id"`
+	Action       string      `json:"action"`
+	Status       string      `json:"status"`
+	Created      time.Time   `json:"created"`
+	Finished     *time.Time  `json:"finished,omitempty"`
+	Applications []*Progress `json:"applications"`
+}
+
+// Operation tracks a single action applied to one or more processes.
+type Operation struct {
+	ID      string
+	status  OperationStatus
+	done    chan struct{}
+	pending int
+	lock    sync.RWMutex
+}
+
+// Snapshot returns a copy which is safe to marshal while the operation runs.
+func (operation *Operation) Snapshot() OperationStatus {
+	operation.lock.RLock()
+	defer operation.lock.RUnlock()
+	snapshot := operation.status
+	snapshot.Applications = make([]*Progress, 0, len(operation.status.Applications))
+	for _, progress := range operation.status.Applications {
+		copied := *progress
+		snapshot.Applications = append(snapshot.Applications, &copied)
+	}
+	return snapshot
+}
+
+// Done returns a channel which is closed when all processes finished.
+func (operation *Operation) Done() <-chan struct{} {
+	return operation.done
+}
+
+func (operation *Operation) finish(progress *Progress, result string, state string, err error) {
+	operation.lock.Lock()
+	defer operation.lock.Unlock()
+	now := time.Now()
+	progress.Status = result
+	progress.State = state
+	progress.Finished = &now
+	if err != nil {
+		progress.Error = err.Error()
+	}
+	operation.pending--
+	if operation.pending > 0 {
+		return
+	}
+	operation.status.Status = OperationSucceeded
+	for _, item := range operation.status.Applications {
+		if item.Status != OperationSucceeded {
+			operation.status.Status = OperationFailed
+		}
+	}
+	operation.status.Finished = &now
+	close(operation.done)
+}
+
+func (operation *Operation) finishedBefore(deadline time.Time) bool {
+	operation.lock.RLock()
+	defer operation.lock.RUnlock()
+	return operation.status.Finished != nil && operation.status.Finished.Before(deadline)
+}
+
+// Operations keeps operations for the retention period and rejects an
+// action on a process which is still part of another running operation.
+type Operations struct {
+	operations map[string]*Operation
+	busy       map[string]string
+	retention  time.Duration
+	timeout    time.Duration
+	lock       sync.Mutex
+}
+
+// Run applies the action to the processes and returns the operation at once;
+// the outcome is tracked in the background. Processes which are part of
+// another running operation, or refuse the action, are marked as rejected.
+func (operations *Operations) Run(action string, processes []*Process) *Operation {
+	operations.lock.Lock()
+	defer operations.lock.Unlock()
+	operations.purge()
+	now := time.Now()
+	id := newOperationId()
+	operation := &Operation{
+		ID:     id,
+		status: OperationStatus{ID: id, Action: action, Status: OperationRunning, Created: now},
+		done:   make(chan struct{})}
+	operations.operations[operation.ID] = operation
+	type accepted struct {
+		proc       *Process
+		progress   *Progress
+		transition Transition
+	}
+	var running []accepted
+	for _, proc := range processes {
+		progress := &Progress{Application: proc.Name, Status: OperationRunning, Started: now}
+		operation.status.Applications = append(operation.status.Applications, progress)
+		if owner, ok := operations.busy[proc.Name]; ok {
+			progress.Status = OperationRejected
+			progress.State = StateName(proc.GetState())
+			progress.Error = "operation " + owner + " in progress"
+			progress.Finished = &now
+			continue
+		}
+		transition := proc.Begin(action)
+		err := proc.apply(action)
+		progress.State = StateName(proc.GetState())
+		if err != nil {
+			progress.Status = OperationRejected
+			progress.Error = err.Error()
+			progress.Finished = &now
+			continue
+		}
+		operations.busy[proc.Name] = operation.ID
+		running = append(running, accepted{proc: proc, progress: progress, transition: transition})
+	}
+	operation.pending = len(running)
+	if operation.pending == 0 {
+		operation.status.Status = OperationFailed
+		operation.status.Finished = &now
+		close(operation.done)
+	}
+	for _, item := range running {
+		go operations.wait(operation, item.progress, item.proc, item.transition)
+	}
+	return operation
+}
+
+func (operations *Operations) wait(operation *Operation, progress *Progress, proc *Process, transition Transition) {
+	ctx, cancel := context.WithTimeout(context.Background(), operations.timeout)
+	defer cancel()
+	finished := proc.WaitFor(ctx, transition)
+	operations.lock.Lock()
+	delete(operations.busy, proc.Name)
+	operations.lock.Unlock()
+	if !finished {
+		operation.finish(progress, OperationTimeout, StateName(proc.GetState()), ctx.Err())
+		return
+	}
+	if !proc.Reached(operation.status.Action) {
+		operation.finish(progress, OperationFailed, StateName(proc.GetState()), proc.GetError())
+		return
+	}
+	operation.finish(progress, OperationSucceeded, StateName(proc.GetState()), nil)
+}
+
+func (operations *Operations) Get(id string) (*Operation, bool) {
+	operations.lock.Lock()
+	defer operations.lock.Unlock()
+	operations.purge()
+	operation, ok := operations.operations[id]
+	return operation, ok
+}
+
+func (operations *Operations) List() []*Operation {
+	operations.lock.Lock()
+	defer operations.lock.Unlock()
+	operations.purge()
+	list := make([]*Operation, 0, len(operations.operations))
+	for _, operation := range operations.operations {
+		list = append(list, operation)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].status.Created.Before(list[j].status.Created)
+	})
+	return list
+}
+
+func (operations *Operations) purge() {
+	deadline := time.Now().Add(-operations.retention)
+	for id, operation := range operations.operations {
+		if operation.finishedBefore(deadline) {
+			delete(operations.operations, id)
+		}
+	}
+}
+
+func newOperationId() string {
+	buffer := make([]byte, 16)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(buffer)
+}
+
+func NewOperations(retention time.Duration, timeout time.Duration) *Operations {
+	return &Operations{
+		operations: make(map[string]*Operation),
+		busy:       make(map[string]string),
+		retention:  retention,
+		timeout:    timeout}
+}
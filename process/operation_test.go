@@ -0,0 +1,155 @@
+package process
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/vvhq/exorsus/application"
+	"github.com/vvhq/exorsus/configuration"
+	"github.com/vvhq/exorsus/events"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testProcess(t *testing.T, app application.Application) *Process {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	config := &configuration.Configuration{LogPath: t.TempDir() + "/"}
+	wg := &sync.WaitGroup{}
+	proc := New(&app, wg, config, nil, events.NewBus(16), logger)
+	t.Cleanup(func() {
+		_ = proc.Stop()
+		proc.close()
+		wg.Wait()
+	})
+	return proc
+}
+
+// stubbornProcess ignores SIGINT, so stopping it takes until the kill timeout.
+func stubbornProcess(t *testing.T, timeout int) *Process {
+	t.Helper()
+	script := filepath.Join(t.TempDir(), "stubborn.sh")
+	err := ioutil.WriteFile(script, []byte("trap '' INT\necho ready\nwhile true; do sleep 0.1; done\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testProcess(t, application.Application{Name: "stubborn", Command: "/bin/sh", Arguments: script, Timeout: timeout, ProcessGroup: true})
+}
+
+// startStubborn starts the process and waits until it ignores SIGINT.
+func startStubborn(t *testing.T, operations *Operations, stubborn *Process) {
+	t.Helper()
+	waitOperation(t, operations.Run(ActionStart, []*Process{stubborn}))
+	deadline := time.Now().Add(10 * time.Second)
+	for stubborn.status.StdOutLen() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("stubborn process did not get ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func waitOperation(t *testing.T, operation *Operation) OperationStatus {
+	t.Helper()
+	select {
+	case <-operation.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("operation %s did not finish", operation.ID)
+	}
+	return operation.Snapshot()
+}
+
+func TestOperationsRun(t *testing.T) {
+	first := testProcess(t, application.Application{Name: "first", Command: "/bin/sleep", Arguments: "30"})
+	second := testProcess(t, application.Application{Name: "second", Command: "/bin/sleep", Arguments: "30"})
+	operations := NewOperations(time.Hour, 10*time.Second)
+
+	result := waitOperation(t, operations.Run(ActionStart, []*Process{first, second}))
+	if result.Status != OperationSucceeded || result.Finished == nil {
+		t.Fatalf("start status = %s, want %s", result.Status, OperationSucceeded)
+	}
+	for _, progress := range result.Applications {
+		if progress.Status != OperationSucceeded || progress.State != "Started" || progress.Finished == nil {
+			t.Errorf("progress = %+v, want succeeded in Started", progress)
+		}
+	}
+
+	result = waitOperation(t, operations.Run(ActionStop, []*Process{first}))
+	if result.Status != OperationSucceeded || result.Applications[0].State != "Stopped" {
+		t.Errorf("stop result = %+v", result)
+	}
+	if found, ok := operations.Get(result.ID); !ok || found.ID != result.ID {
+		t.Errorf("Get(%s) did not find the operation", result.ID)
+	}
+	if list := operations.List(); len(list) != 2 {
+		t.Errorf("List() returned %d operations, want 2", len(list))
+	}
+}
+
+func TestOperationsRejectBusy(t *testing.T) {
+	stubborn := stubbornProcess(t, 1)
+	operations := NewOperations(time.Hour, 10*time.Second)
+	startStubborn(t, operations, stubborn)
+
+	stopping := operations.Run(ActionStop, []*Process{stubborn})
+	rejected := waitOperation(t, operations.Run(ActionStop, []*Process{stubborn}))
+	if rejected.Status != OperationFailed || rejected.Applications[0].Status != OperationRejected {
+		t.Errorf("conflicting operation = %+v, want rejected", rejected.Applications[0])
+	}
+	if want := "operation " + stopping.ID + " in progress"; rejected.Applications[0].Error != want {
+		t.Errorf("error = %q, want %q", rejected.Applications[0].Error, want)
+	}
+	if result := waitOperation(t, stopping); result.Status != OperationSucceeded {
+		t.Errorf("stop status = %s, want %s", result.Status, OperationSucceeded)
+	}
+}
+
+func TestOperationsFailures(t *testing.T) {
+	missing := testProcess(t, application.Application{Name: "missing", Command: "/nonexistent/command"})
+	operations := NewOperations(time.Hour, 10*time.Second)
+
+	result := waitOperation(t, operations.Run(ActionStart, []*Process{missing}))
+	if result.Status != OperationFailed || result.Applications[0].Status != OperationFailed || result.Applications[0].Error == "" {
+		t.Errorf("start of missing command = %+v, want failed with error", result.Applications[0])
+	}
+
+	result = waitOperation(t, operations.Run("bogus", []*Process{missing}))
+	if result.Applications[0].Status != OperationRejected || result.Applications[0].Error != ErrUnknownAction.Error() {
+		t.Errorf("unknown action = %+v, want rejected", result.Applications[0])
+	}
+
+	result = waitOperation(t, operations.Run(ActionStop, []*Process{missing}))
+	if result.Applications[0].Status != OperationRejected || result.Applications[0].Error != ErrAlreadyStopped.Error() {
+		t.Errorf("stop of stopped process = %+v, want rejected", result.Applications[0])
+	}
+}
+
+func TestOperationsTimeout(t *testing.T) {
+	stubborn := stubbornProcess(t, 2)
+	operations := NewOperations(time.Hour, 100*time.Millisecond)
+	startStubborn(t, operations, stubborn)
+	result := waitOperation(t, operations.Run(ActionStop, []*Process{stubborn}))
+	if result.Status != OperationFailed || result.Applications[0].Status != OperationTimeout {
+		t.Errorf("stop = %+v, want timeout", result.Applications[0])
+	}
+}
+
+func TestOperationsPurge(t *testing.T) {
+	operations := NewOperations(20*time.Millisecond, time.Second)
+	operation := operations.Run(ActionStart, nil)
+	if result := waitOperation(t, operation); result.Status != OperationFailed {
+		t.Errorf("operation without processes = %s, want %s", result.Status, OperationFailed)
+	}
+	if _, ok := operations.Get(operation.ID); !ok {
+		t.Fatal("finished operation purged before the retention period")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, ok := operations.Get(operation.ID); ok {
+		t.Error("operation kept after the retention period")
+	}
+	if list := operations.List(); len(list) != 0 {
+		t.Errorf("List() returned %d operations after purge", len(list))
+	}
+}
@@ -1,11 +1,15 @@
 package process
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"github.com/vvhq/exorsus/application"
 	"github.com/vvhq/exorsus/configuration"
+	"github.com/vvhq/exorsus/events"
+	"github.com/vvhq/exorsus/forwarding"
 	"github.com/vvhq/exorsus/logging"
 	"github.com/vvhq/exorsus/status"
 	"io"
@@ -14,6 +18,7 @@ import (
 	"os/user"
 	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -22,32 +27,129 @@ import (
 )
 
 type Process struct {
-	Name          string
-	app           *application.Application
-	status        *status.Status
-	command       *exec.Cmd
-	mainWaitGroup *sync.WaitGroup
-	config        *configuration.Configuration
-	stdLogger     *logrus.Logger
-	logger        *logrus.Logger
+	Name           string
+	app            *application.Application
+	status         *status.Status
+	command        *exec.Cmd
+	mainWaitGroup  *sync.WaitGroup
+	config         *configuration.Configuration
+	stdLogger      *logrus.Logger
+	logPath        string
+	mirror         *logging.Mirror
+	forwarder      *forwarding.Forwarder
+	bus            *events.Bus
+	subscription   *events.Subscription
+	redeliver      chan events.Event
+	commands       chan command
+	exited         chan error
+	prestartDone   chan struct{}
+	done           chan struct{}
+	machine        machine
+	stdin          *os.File
+	stdinLock      sync.Mutex
+	stdinWriteLock sync.Mutex
+	terminal       *terminal
+	terminalLock   sync.Mutex
+	logger         *logrus.Logger
+}
+
+var ErrNotFound = errors.New("application not found")
+var ErrBusy = errors.New("process busy")
+var ErrAlreadyStarted = errors.New("process already started")
+var ErrAlreadyStopped = errors.New("process already stopped")
+var ErrUnknownAction = errors.New("unknown action")
+var ErrClosed = errors.New("process removed")
+
+// maxLineSize is the longest line of output passed on as one item.
+const maxLineSize int = 64 * 1024
+
+const ActionStart string = "start"
+const ActionStop string = "stop"
+const ActionRestart string = "restart"
+
+var states = []string{"Stopped", "Started", "Stopping", "Starting", "Failed"}
+
+func StateName(state int) string {
+	if state < 0 || state >= len(states) {
+		return "Unknown"
+	}
+	return states[state]
 }
 
-func (process *Process) Start() {
-	process.mainWaitGroup.Add(1)
-	go process.start()
+func (process *Process) Start() error {
+	return process.send(ActionStart)
 }
 
-func (process *Process) Stop() {
-	process.mainWaitGroup.Add(1)
-	go process.stop()
+func (process *Process) Stop() error {
+	return process.send(ActionStop)
 }
 
-func (process *Process) Restart() {
-	process.mainWaitGroup.Add(2)
-	go func() {
-		process.stop()
-		process.start()
-	}()
+func (process *Process) Restart() error {
+	return process.send(ActionRestart)
+}
+
+func (process *Process) apply(action string) error {
+	switch action {
+	case ActionStart:
+		return process.Start()
+	case ActionStop:
+		return process.Stop()
+	case ActionRestart:
+		return process.Restart()
+	}
+	return ErrUnknownAction
+}
+
+// Transition remembers the state counters taken right before an action,
+// so WaitFor can tell the outcome of that action from earlier states.
+type Transition struct {
+	action string
+	starts uint64
+	stops  uint64
+}
+
+func (process *Process) Begin(action string) Transition {
+	return Transition{
+		action: action,
+		starts: process.status.Entered(status.Starting),
+		stops:  process.status.Entered(status.Stopping)}
+}
+
+// WaitFor blocks until the action of the transition has finished, either in
+// its target state or in a failure state. It returns false when ctx is done first.
+func (process *Process) WaitFor(ctx context.Context, transition Transition) bool {
+	for {
+		changed := process.status.Changed()
+		if process.finished(transition) {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func (process *Process) finished(transition Transition) bool {
+	state := process.status.GetState()
+	if state == status.Failed {
+		return true
+	}
+	switch transition.action {
+	case ActionStop:
+		return state == status.Stopped && process.status.Entered(status.Stopping) > transition.stops
+	default:
+		return state != status.Starting && process.status.Entered(status.Starting) > transition.starts
+	}
+}
+
+// Reached reports whether the process is in the target state of the action.
+func (process *Process) Reached(action string) bool {
+	if action == ActionStop {
+		return process.status.GetState() == status.Stopped
+	}
+	return process.status.GetState() == status.Started
 }
 
 func (process *Process) GetPid() int {
@@ -66,19 +168,77 @@ func (process *Process) GetState() int {
 	return process.status.GetState()
 }
 
-func (process *Process) GetStdOut() []string {
-	return process.status.ListStdOutItems()
+func (process *Process) GetStdOut(format status.TimeFormat) []string {
+	return process.status.ListStdOutItems(format)
 }
 
-func (process *Process) GetStdErr() []string {
-	return process.status.ListStdErrItems()
+func (process *Process) GetStdErr(format status.TimeFormat) []string {
+	return process.status.ListStdErrItems(format)
+}
+
+// GetLogs merges captured stdout and stderr items in time order, keeping
+// the requested stream ("" for both) at or above the given level.
+func (process *Process) GetLogs(stream string, level string) []status.Item {
+	stdOut := stream == "" || stream == status.StreamStdOut
+	stdErr := stream == "" || stream == status.StreamStdErr
+	outLen, errLen := 0, 0
+	if stdOut {
+		outLen = process.status.StdOutLen()
+	}
+	if stdErr {
+		errLen = process.status.StdErrLen()
+	}
+	// Each stream is read into its own part of one buffer, so lines captured
+	// meanwhile only push out the oldest lines of their own stream.
+	buffer := make([]status.Item, outLen+errLen)
+	items := buffer[:0]
+	if stdOut {
+		items = process.status.ReadStdOutItems(buffer[:0:outLen])
+	}
+	if stdErr {
+		items = append(items, process.status.ReadStdErrItems(buffer[outLen:outLen:outLen+errLen])...)
+	}
+	if level != "" {
+		minRank := status.LevelRank(level)
+		filtered := items[:0]
+		for _, item := range items {
+			if status.LevelRank(item.Level) >= minRank {
+				filtered = append(filtered, item)
+			}
+		}
+		items = filtered
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Time.Before(items[j].Time)
+	})
+	return items
 }
 
 func (process *Process) Zombie() bool {
-	_, err := os.Stat(fmt.Sprintf("/proc/%d", process.getCurrentPid()))
+	_, err := os.Stat(fmt.Sprintf("/proc/%d", process.status.GetPid()))
 	return !os.IsNotExist(err) && process.status.GetState() == status.Failed
 }
 
+// Required reports whether exorsus is not ready without the process.
+func (process *Process) Required() bool {
+	return process.app.Required
+}
+
+// Healthy reports whether the process is started and not crash looping.
+func (process *Process) Healthy() bool {
+	return process.status.GetState() == status.Started && !process.status.CrashLoop()
+}
+
+func trimLineEnd(line []byte) []byte {
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		line = line[:len(line)-1]
+		if len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+	}
+	return line
+}
+
 func (process *Process) getCurrentPid() int {
 	currentPid := 0
 	if process.command != nil && process.command.Process != nil {
@@ -87,17 +247,30 @@ func (process *Process) getCurrentPid() int {
 	return currentPid
 }
 
-func (process *Process) pipe2Channel(pipe io.Reader, channel chan<- string) {
+// pipe2Channel copies lines from the pipe to the channel and closes both at
+// EOF, which comes when the process and all its children closed the pipe.
+// Blank lines are kept; lines longer than maxLineSize are split.
+func (process *Process) pipe2Channel(pipe io.ReadCloser, channel chan<- string) {
 	process.mainWaitGroup.Add(1)
 	go func() {
 		defer process.mainWaitGroup.Done()
-		buffer := make([]byte, 4096, 4096)
+		defer close(channel)
+		defer pipe.Close()
+		reader := bufio.NewReaderSize(pipe, 4096)
+		var line []byte
 		for {
-			numberBytesRead, err := pipe.Read(buffer)
-			if numberBytesRead > 0 {
-				bytesRead := buffer[:numberBytesRead]
-				channel <- strings.TrimRight(string(bytesRead), "\n")
+			fragment, err := reader.ReadSlice('\n')
+			line = append(line, fragment...)
+			if err == bufio.ErrBufferFull {
+				if len(line) < maxLineSize {
+					continue
+				}
+				err = nil
+			}
+			if err == nil || len(line) > 0 {
+				channel <- string(trimLineEnd(line))
 			}
+			line = line[:0]
 			if err != nil {
 				if err != io.EOF {
 					process.logger.
@@ -113,49 +286,94 @@ func (process *Process) pipe2Channel(pipe io.Reader, channel chan<- string) {
 	}()
 }
 
-func (process *Process) stdOutChannelHandler(channel <-chan string) {
+// stdOutChannelHandler passes lines to control first, when set, and skips
+// the ones it consumed.
+func (process *Process) stdOutChannelHandler(channel <-chan string, output *sync.WaitGroup, control func(string) bool) {
 	process.mainWaitGroup.Add(1)
+	output.Add(1)
 	go func() {
 		defer process.mainWaitGroup.Done()
-		for {
-			item, out := <-channel
-			if out {
-				process.status.AddStdOutItem(item)
-				process.stdLogger.
-					WithField("source", "process").
-					WithField("process", process.Name).
-					WithField("state", process.GetState()).
-					WithField("item", item).
-					Info("STDOUT message")
-			} else {
-				break
+		defer output.Done()
+		process.collect(channel, func(line string) {
+			if control != nil && control(line) {
+				return
 			}
-		}
+			item := parseLine(process.app.LogFormat, status.StreamStdOut, line)
+			process.status.AddStdOutItem(item)
+			if process.mirror != nil {
+				process.mirror.StdOut(line)
+			}
+			process.forward(item)
+			process.writeStdLog(item)
+		})
 	}()
 }
 
-func (process *Process) stdErrChannelHandler(channel <-chan string) {
+func (process *Process) stdErrChannelHandler(channel <-chan string, output *sync.WaitGroup) {
 	process.mainWaitGroup.Add(1)
+	output.Add(1)
 	go func() {
 		defer process.mainWaitGroup.Done()
-		for {
-			item, out := <-channel
-			if out {
-				process.status.AddStdErrItem(item)
-				process.stdLogger.WithField("SOURCE", "Process").WithField("NAME", process.Name).Error(item)
-			} else {
-				break
+		defer output.Done()
+		process.collect(channel, func(line string) {
+			item := parseLine(process.app.LogFormat, status.StreamStdErr, line)
+			process.status.AddStdErrItem(item)
+			if process.mirror != nil {
+				process.mirror.StdErr(line)
 			}
-		}
+			process.forward(item)
+			process.writeStdLog(item)
+		})
 	}()
 }
 
-func (process *Process) preStart(stdOutChan chan<- string) {
+func (process *Process) forward(item status.Item) {
+	level, err := logrus.ParseLevel(item.Level)
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+	process.forwarder.Push(forwarding.Entry{
+		Time:    item.Time,
+		Level:   level,
+		Source:  process.Name,
+		Stream:  item.Stream,
+		Message: item.Message,
+		Fields:  item.Fields})
+}
+
+func (process *Process) writeStdLog(item status.Item) {
+	if process.app.LogFormat == "" || process.app.LogFormat == configuration.LogFormatText {
+		if item.Stream == status.StreamStdErr {
+			process.stdLogger.WithField("SOURCE", "Process").WithField("NAME", process.Name).Error(item.Line)
+		} else {
+			process.stdLogger.
+				WithField("source", "process").
+				WithField("process", process.Name).
+				WithField("state", process.GetState()).
+				WithField("item", item.Line).
+				Info("STDOUT message")
+		}
+		return
+	}
+	level, err := logrus.ParseLevel(item.Level)
+	if err != nil || level == logrus.PanicLevel {
+		level = logrus.InfoLevel
+	}
+	process.stdLogger.
+		WithFields(item.Fields).
+		WithField("source", "process").
+		WithField("process", process.Name).
+		WithField("stream", item.Stream).
+		WithTime(item.Time).
+		Log(level, item.Message)
+}
+
+func (process *Process) preStart(parent context.Context, stdOutChan chan<- string) {
 	preTimeout := process.app.PreStart.Timeout
 	if preTimeout == 0 {
 		preTimeout = configuration.DefaultShutdownTimeout
 	}
-	preContext, preCancel := context.WithTimeout(context.Background(), time.Duration(preTimeout)*time.Second)
+	preContext, preCancel := context.WithTimeout(parent, time.Duration(preTimeout)*time.Second)
 	defer preCancel()
 	preArguments := strings.Fields(strings.TrimSpace(process.app.PreStart.Arguments))
 	preCommand := exec.CommandContext(preContext, process.app.PreStart.Command, preArguments...)
@@ -171,10 +389,7 @@ func (process *Process) preStart(stdOutChan chan<- string) {
 		preCommand.SysProcAttr = &syscall.SysProcAttr{}
 		preCommand.SysProcAttr.Credential = process.findCredential()
 	}
-	preCommand.Env = os.Environ()
-	for _, env := range process.app.Environment {
-		preCommand.Env = append(process.command.Env, fmt.Sprintf("%s=%s", env.Name, env.Value))
-	}
+	preCommand.Env = process.environment()
 	process.logger.
 		WithField("source", "preprocess").
 		WithField("path", preCommand.Path).
@@ -190,262 +405,24 @@ func (process *Process) preStart(stdOutChan chan<- string) {
 			WithField("error", preContext.Err().Error()).
 			Error("Pre process command timed out")
 	}
-	if preErr != nil {
+	if preErr != nil && parent.Err() != nil {
 		process.logger.
 			WithField("source", "preprocess").
 			WithField("process", process.Name).
 			WithField("state", process.GetState()).
-			WithField("error", preErr.Error()).
-			Error("Pre process command exit with non zero exit code")
-	}
-
-	stdOutChan <- strings.Join(preCommand.Args, " ")
-	stdOutChan <- strings.TrimRight(string(preOut), "\n")
-}
-
-func (process *Process) start() {
-	defer process.mainWaitGroup.Done()
-	if process.status.GetState() == status.Started {
-		process.logger.
-			WithField("source", "process").
-			WithField("process", process.Name).
-			WithField("state", process.GetState()).
-			WithField("operation", "start").
-			Warn("Process already started")
-		return
-	}
-	if process.status.GetState() != status.Stopped {
-		process.logger.
-			WithField("source", "process").
-			WithField("process", process.Name).
-			WithField("state", process.GetState()).
-			WithField("operation", "start").
-			Warn("process busy")
-		return
-	}
-
-	process.status.SetState(status.Starting)
-	process.status.SetPid(process.getCurrentPid())
-	process.status.SetExitCode(0)
-	process.status.SetError(nil)
-
-	arguments := strings.Fields(strings.TrimSpace(process.app.Arguments))
-
-	process.command = exec.Command(process.app.Command, arguments...)
-	process.command.Dir = process.app.WorkDir
-
-	if process.findCredential() != nil {
-		process.logger.
-			WithField("source", "process").
-			WithField("process", process.Name).
-			WithField("state", process.GetState()).
-			WithField("user", process.app.User).
-			WithField("group", process.app.Group).
-			Trace("Start process as specific user/group")
-		process.command.SysProcAttr = &syscall.SysProcAttr{}
-		process.command.SysProcAttr.Credential = process.findCredential()
-	}
-
-	process.command.Env = os.Environ()
-	for _, env := range process.app.Environment {
-		process.command.Env = append(process.command.Env, fmt.Sprintf("%s=%s", env.Name, env.Value))
-	}
-
-	stdOutChan := make(chan string, 4096)
-	stdErrChan := make(chan string, 4096)
-	stdOutPipe, err := process.command.StdoutPipe()
-	if err != nil {
-		process.logger.
-			WithField("source", "process").
-			WithField("process", process.Name).
-			WithField("state", process.GetState()).
-			WithField("error", err.Error()).
-			Error("Can not create stdout pipe")
-	} else {
-		process.pipe2Channel(stdOutPipe, stdOutChan)
-		process.stdOutChannelHandler(stdOutChan)
-	}
-	stdErrPipe, err := process.command.StderrPipe()
-	if err != nil {
-		process.logger.
-			WithField("source", "process").
-			WithField("process", process.Name).
-			WithField("state", process.GetState()).
-			WithField("error", err.Error()).
-			Error("Can not create stderr pipe")
-	} else {
-		process.pipe2Channel(stdErrPipe, stdErrChan)
-		process.stdErrChannelHandler(stdErrChan)
-	}
-
-	if process.app.PreStart.Command != "" {
-		process.preStart(stdOutChan)
-	}
-
-	process.logger.
-		WithField("source", "process").
-		WithField("path", process.command.Path).
-		WithField("dir", process.command.Dir).
-		WithField("args", process.command.Args).
-		Trace("About to start command")
-
-	err = process.command.Start()
-	if err != nil {
-		process.status.SetState(status.Stopped)
-		process.status.SetPid(process.getCurrentPid())
-		process.status.SetError(err)
-		process.status.SetExitCode(-1)
-		close(stdOutChan)
-		close(stdErrChan)
+			Info("Pre process command cancelled")
+	} else if preErr != nil {
 		process.logger.
-			WithField("source", "process").
-			WithField("process", process.Name).
-			WithField("state", process.GetState()).
-			WithField("error", err.Error()).
-			Error("Can not start process")
-		return
-	}
-	process.status.SetState(status.Started)
-	process.status.SetPid(process.getCurrentPid())
-
-	err = process.command.Wait()
-	if err != nil {
-		process.status.SetExitCode(-1)
-		exitError, ok := err.(*exec.ExitError)
-		if ok {
-			exitStatus, ok := exitError.Sys().(syscall.WaitStatus)
-			if ok {
-				process.status.SetExitCode(exitStatus.ExitStatus())
-			}
-		}
-		process.status.SetError(err)
-		process.logger.
-			WithField("source", "process").
+			WithField("source", "preprocess").
 			WithField("process", process.Name).
 			WithField("state", process.GetState()).
-			WithField("error", err.Error()).
-			Error("Error waiting for process")
-	} else {
-		process.status.SetError(nil)
-		process.status.SetExitCode(0)
+			WithField("error", preErr.Error()).
+			Error("Pre process command exit with non zero exit code")
 	}
-	close(stdOutChan)
-	close(stdErrChan)
-	process.status.SetState(status.Stopped)
-}
 
-func (process *Process) stop() {
-	defer process.mainWaitGroup.Done()
-	if process.status.GetState() == status.Stopped {
-		process.logger.
-			WithField("source", "process").
-			WithField("process", process.Name).
-			WithField("state", process.GetState()).
-			WithField("operation", "stop").
-			Trace("Process already stopped")
-		return
-	}
-	if process.status.GetState() != status.Started {
-		process.logger.
-			WithField("source", "process").
-			WithField("process", process.Name).
-			WithField("state", process.GetState()).
-			WithField("operation", "stop").
-			Warn("Process busy")
-		return
-	}
-	process.status.SetState(status.Stopping)
-	process.status.SetError(nil)
-	process.status.SetExitCode(-1)
-	err := process.command.Process.Signal(syscall.SIGINT)
-	if err != nil {
-		process.status.SetExitCode(0)
-		exitError, okErrCast := err.(*exec.ExitError)
-		if okErrCast {
-			exitStatus, okStatusCast := exitError.Sys().(syscall.WaitStatus)
-			if okStatusCast {
-				process.status.SetExitCode(exitStatus.ExitStatus())
-			}
-		}
-		process.status.SetPid(process.getCurrentPid())
-		process.status.SetError(err)
-		process.logger.
-			WithField("source", "process").
-			WithField("process", process.Name).
-			WithField("state", process.GetState()).
-			WithField("pid", fmt.Sprintf("%d", process.status.GetPid())).
-			WithField("code", fmt.Sprintf("%d", process.status.GetExitCode())).
-			WithField("error", err.Error()).
-			Error("Can not gracefully stop process")
-	} else {
-		process.status.SetPid(process.getCurrentPid())
-		process.status.SetState(status.Stopped)
-		process.status.SetError(nil)
-		process.status.SetExitCode(0)
-		process.logger.
-			WithField("source", "process").
-			WithField("process", process.Name).
-			WithField("state", process.GetState()).
-			WithField("pid", fmt.Sprintf("%d", process.status.GetPid())).
-			WithField("code", fmt.Sprintf("%d", process.status.GetExitCode())).
-			Trace("Process stopped successfully")
-	}
-	time.Sleep(time.Second * time.Duration(process.app.Timeout+10))
-	if process.status.GetState() != status.Stopped {
-		err := process.command.Process.Kill()
-		if err != nil {
-			process.status.SetExitCode(0)
-			exitError, okErrCast := err.(*exec.ExitError)
-			if okErrCast {
-				exitStatus, okStatusCast := exitError.Sys().(syscall.WaitStatus)
-				if okStatusCast {
-					process.status.SetExitCode(exitStatus.ExitStatus())
-				}
-			}
-			process.status.SetPid(process.getCurrentPid())
-			process.status.SetError(err)
-			process.logger.
-				WithField("source", "process").
-				WithField("process", process.Name).
-				WithField("state", process.GetState()).
-				WithField("pid", fmt.Sprintf("%d", process.status.GetPid())).
-				WithField("code", fmt.Sprintf("%d", process.status.GetExitCode())).
-				WithField("error", err.Error()).
-				Error("Can not KILL process")
-			process.status.SetError(err)
-		} else {
-			process.status.SetPid(process.getCurrentPid())
-			process.status.SetState(status.Stopped)
-			process.status.SetError(nil)
-			process.status.SetExitCode(0)
-			process.logger.
-				WithField("source", "process").
-				WithField("process", process.Name).
-				WithField("state", process.GetState()).
-				WithField("pid", fmt.Sprintf("%d", process.status.GetPid())).
-				WithField("code", fmt.Sprintf("%d", process.status.GetExitCode())).
-				Trace("process stopped")
-		}
-	}
-	if _, err := os.Stat(fmt.Sprintf("/proc/%d", process.getCurrentPid())); !os.IsNotExist(err) {
-		process.status.SetState(status.Failed)
-		process.status.SetExitCode(-1)
-		process.logger.
-			WithField("source", "process").
-			WithField("process", process.Name).
-			WithField("state", process.GetState()).
-			WithField("pid", fmt.Sprintf("%d", process.status.GetPid())).
-			WithField("code", fmt.Sprintf("%d", process.status.GetExitCode())).
-			WithField("error", err.Error()).
-			Error("Process running detached")
-	} else {
-		process.logger.
-			WithField("source", "process").
-			WithField("process", process.Name).
-			WithField("state", process.GetState()).
-			WithField("pid", fmt.Sprintf("%d", process.status.GetPid())).
-			WithField("code", fmt.Sprintf("%d", process.status.GetExitCode())).
-			Trace("Process does not exists")
+	if stdOutChan != nil {
+		stdOutChan <- strings.Join(preCommand.Args, " ")
+		stdOutChan <- strings.TrimRight(string(preOut), "\n")
 	}
 }
 
@@ -478,7 +455,7 @@ func (process *Process) findCredential() *syscall.Credential {
 
 }
 
-func New(app *application.Application, status *status.Status, wg *sync.WaitGroup, config *configuration.Configuration, logger *logrus.Logger) *Process {
+func New(app *application.Application, wg *sync.WaitGroup, config *configuration.Configuration, forwarder *forwarding.Forwarder, bus *events.Bus, logger *logrus.Logger) *Process {
 	logPath := path.Join(path.Dir(config.LogPath), fmt.Sprintf("app_%s.json", app.Name))
 	hostName, err := os.Hostname()
 	if err == nil {
@@ -488,6 +465,7 @@ func New(app *application.Application, status *status.Status, wg *sync.WaitGroup
 	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
 		logFile = os.Stdout
+		logPath = ""
 		logger.
 			WithField("source", "process").
 			WithField("process", app.Name).
@@ -495,22 +473,64 @@ func New(app *application.Application, status *status.Status, wg *sync.WaitGroup
 			Error("Can not open log file")
 	}
 	stdLogger := logging.NewLogger(logFile, logrus.TraceLevel)
-	stdLogger.SetFormatter(&logrus.JSONFormatter{})
-	return &Process{Name: app.Name, app: app, status: status, mainWaitGroup: wg, config: config, stdLogger: stdLogger, logger: logger}
+	stdLogger.SetFormatter(&logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+	var mirror *logging.Mirror
+	mirrorMode := config.GetMirrorOutput(app.Mirror)
+	if mirrorMode != configuration.MirrorOff {
+		mirror = logging.NewMirror(app.Name, mirrorMode == configuration.MirrorRaw, config.MirrorColor, os.Stdout, os.Stderr)
+	}
+	procStatus := status.New(config.GetMaxStdLines(app.MaxLines), config.GetMaxStdBytes(app.MaxBytes))
+	proc := &Process{
+		Name:          app.Name,
+		app:           app,
+		status:        procStatus,
+		mainWaitGroup: wg,
+		config:        config,
+		stdLogger:     stdLogger,
+		logPath:       logPath,
+		mirror:        mirror,
+		forwarder:     forwarder,
+		bus:           bus,
+		commands:      make(chan command),
+		exited:        make(chan error, 1),
+		prestartDone:  make(chan struct{}, 1),
+		done:          make(chan struct{}),
+		logger:        logger}
+	if app.Listener.Enabled && bus != nil {
+		filter := events.Filter{Applications: app.Listener.Applications, Types: app.Listener.Events}
+		proc.subscription, _ = bus.Subscribe(filter, 0)
+		proc.redeliver = make(chan events.Event, 1)
+	}
+	if app.Listener.Enabled && (app.Stdin == configuration.StdinPipe || app.Tty) {
+		logger.
+			WithField("source", "process").
+			WithField("process", app.Name).
+			Warn("Stdin of event listener is reserved for events, stdin pipe and tty disabled")
+	} else if app.Tty && app.Stdin == configuration.StdinPipe {
+		logger.
+			WithField("source", "process").
+			WithField("process", app.Name).
+			Warn("Stdin of tty application is its terminal, stdin pipe disabled")
+	}
+	go proc.run()
+	return proc
 }
 
 type Status struct {
-	Name         string   `json:"name"`
-	Pid          int      `json:"pid"`
-	Code         int      `json:"code"`
-	StartupError string   `json:"error"`
-	State        string   `json:"state"`
-	StdOut       []string `json:"stdout"`
-	StdErr       []string `json:"stderr"`
-}
-
-func NewStatus(process *Process) Status {
-	states := []string{"Stopped", "Started", "Stopping", "Starting", "Failed"}
+	Name               string   `json:"name"`
+	Pid                int      `json:"pid"`
+	Code               int      `json:"code"`
+	StartupError       string   `json:"error"`
+	State              string   `json:"state"`
+	StdOut             []string `json:"stdout"`
+	StdErr             []string `json:"stderr"`
+	StdOutDroppedLines uint64   `json:"stdout_dropped_lines"`
+	StdOutDroppedBytes uint64   `json:"stdout_dropped_bytes"`
+	StdErrDroppedLines uint64   `json:"stderr_dropped_lines"`
+	StdErrDroppedBytes uint64   `json:"stderr_dropped_bytes"`
+}
+
+func NewStatus(process *Process, format status.TimeFormat) Status {
 	errorMessage := ""
 	if process.GetError() != nil {
 		errorMessage = process.GetError().Error()
@@ -520,12 +540,45 @@ func NewStatus(process *Process) Status {
 		Pid:          process.GetPid(),
 		Code:         process.GetExitCode(),
 		StartupError: errorMessage,
-		State:        states[process.GetState()],
-		StdOut:       process.GetStdOut(),
-		StdErr:       process.GetStdErr()}
+		State:        StateName(process.GetState()),
+		StdOut:       process.GetStdOut(format),
+		StdErr:       process.GetStdErr(format)}
+	procStatus.StdOutDroppedLines, procStatus.StdOutDroppedBytes = process.status.StdOutDropped()
+	procStatus.StdErrDroppedLines, procStatus.StdErrDroppedBytes = process.status.StdErrDropped()
 	return procStatus
 }
 
+// Metrics is a snapshot of the counters of a process.
+type Metrics struct {
+	Name               string
+	State              int
+	Healthy            bool
+	Pid                int
+	Code               int
+	Starts             uint64
+	StartTime          time.Time
+	StdOutLines        uint64
+	StdErrLines        uint64
+	StdOutDroppedLines uint64
+	StdErrDroppedLines uint64
+}
+
+func NewMetrics(process *Process) Metrics {
+	procMetrics := Metrics{
+		Name:        process.Name,
+		State:       process.GetState(),
+		Healthy:     process.Healthy(),
+		Pid:         process.GetPid(),
+		Code:        process.GetExitCode(),
+		Starts:      process.status.Entered(status.Starting),
+		StartTime:   process.status.GetStartTime(),
+		StdOutLines: process.status.StdOutLines(),
+		StdErrLines: process.status.StdErrLines()}
+	procMetrics.StdOutDroppedLines, _ = process.status.StdOutDropped()
+	procMetrics.StdErrDroppedLines, _ = process.status.StdErrDropped()
+	return procMetrics
+}
+
 type Manager struct {
 	processes     sync.Map
 	mainWaitGroup *sync.WaitGroup
@@ -540,7 +593,8 @@ func (manager *Manager) Delete(name string) {
 	value, ok := manager.processes.Load(name)
 	if ok {
 		proc := value.(*Process)
-		proc.Stop()
+		_ = proc.Stop()
+		proc.close()
 		manager.processes.Delete(name)
 	}
 }
@@ -569,28 +623,40 @@ func (manager *Manager) RestartAll() {
 	})
 }
 
-func (manager *Manager) Start(name string) {
+func (manager *Manager) Start(name string) error {
 	value, ok := manager.processes.Load(name)
 	if ok {
 		proc := value.(*Process)
-		proc.Start()
+		return proc.Start()
 	}
+	return ErrNotFound
 }
 
-func (manager *Manager) Stop(name string) {
+func (manager *Manager) Stop(name string) error {
 	value, ok := manager.processes.Load(name)
 	if ok {
 		proc := value.(*Process)
-		proc.Stop()
+		return proc.Stop()
 	}
+	return ErrNotFound
 }
 
-func (manager *Manager) Restart(name string) {
+func (manager *Manager) Restart(name string) error {
 	value, ok := manager.processes.Load(name)
 	if ok {
 		proc := value.(*Process)
-		proc.Restart()
+		return proc.Restart()
+	}
+	return ErrNotFound
+}
+
+func (manager *Manager) Signal(name string, signal syscall.Signal) error {
+	value, ok := manager.processes.Load(name)
+	if ok {
+		proc := value.(*Process)
+		return proc.Signal(signal)
 	}
+	return ErrNotFound
 }
 
 func (manager *Manager) List() []*Process {
@@ -602,27 +668,63 @@ func (manager *Manager) List() []*Process {
 	return processes
 }
 
-func (manager *Manager) StatusAll() []Status {
+func (manager *Manager) StatusAll(format status.TimeFormat) []Status {
 	var allStatus []Status
 	manager.processes.Range(func(key, value interface{}) bool {
 		proc := value.(*Process)
-		procStatus := NewStatus(proc)
+		procStatus := NewStatus(proc, format)
 		allStatus = append(allStatus, procStatus)
 		return true
 	})
 	return allStatus
 }
 
-func (manager *Manager) Status(name string) (Status, bool) {
+func (manager *Manager) MetricsAll() []Metrics {
+	var allMetrics []Metrics
+	manager.processes.Range(func(key, value interface{}) bool {
+		allMetrics = append(allMetrics, NewMetrics(value.(*Process)))
+		return true
+	})
+	return allMetrics
+}
+
+func (manager *Manager) Status(name string, format status.TimeFormat) (Status, bool) {
 	value, ok := manager.processes.Load(name)
 	if ok {
 		proc := value.(*Process)
-		procStatus := NewStatus(proc)
+		procStatus := NewStatus(proc, format)
 		return procStatus, true
 	}
 	return Status{}, false
 }
 
+func (manager *Manager) Logs(name string, stream string, level string) ([]status.Item, bool) {
+	value, ok := manager.processes.Load(name)
+	if ok {
+		proc := value.(*Process)
+		return proc.GetLogs(stream, level), true
+	}
+	return nil, false
+}
+
+// TailStdErr returns the last lines captured from stderr of the process.
+func (manager *Manager) TailStdErr(name string, lines int) []string {
+	value, ok := manager.processes.Load(name)
+	if !ok || lines <= 0 {
+		return []string{}
+	}
+	procStatus := value.(*Process).status
+	if lines > procStatus.StdErrLen() {
+		lines = procStatus.StdErrLen()
+	}
+	items := procStatus.ReadStdErrItems(make([]status.Item, lines))
+	tail := make([]string, 0, len(items))
+	for _, item := range items {
+		tail = append(tail, item.Line)
+	}
+	return tail
+}
+
 func NewManager(wg *sync.WaitGroup, logger *logrus.Logger) *Manager {
 	return &Manager{mainWaitGroup: wg, logger: logger}
 }
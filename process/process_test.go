@@ -0,0 +1,44 @@
+package process
+
+import (
+	"github.com/vvhq/exorsus/application"
+	"github.com/vvhq/exorsus/status"
+	"testing"
+	"time"
+)
+
+func TestGetLogs(t *testing.T) {
+	proc := testProcess(t, application.Application{Name: "logs", Command: "/bin/true"})
+	started := time.Now()
+	for idx, stream := range []string{status.StreamStdOut, status.StreamStdErr, status.StreamStdOut, status.StreamStdErr, status.StreamStdOut} {
+		item := status.Item{Time: started.Add(time.Duration(idx) * time.Second), Stream: stream, Level: "info", Message: string(rune('a' + idx))}
+		if idx == 3 {
+			item.Level = "error"
+		}
+		if stream == status.StreamStdOut {
+			proc.status.AddStdOutItem(item)
+		} else {
+			proc.status.AddStdErrItem(item)
+		}
+	}
+
+	tests := []struct {
+		stream string
+		level  string
+		want   string
+	}{
+		{"", "", "abcde"},
+		{status.StreamStdOut, "", "ace"},
+		{status.StreamStdErr, "", "bd"},
+		{"", "error", "d"},
+	}
+	for _, test := range tests {
+		got := ""
+		for _, item := range proc.GetLogs(test.stream, test.level) {
+			got += item.Message
+		}
+		if got != test.want {
+			t.Errorf("GetLogs(%q, %q) = %q, want %q", test.stream, test.level, got, test.want)
+		}
+	}
+}
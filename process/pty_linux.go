@@ -0,0 +1,71 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+func ioctl(file *os.File, request uintptr, argument uintptr) error {
+	connection, err := file.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ioctlErr error
+	// Control keeps the descriptor non-blocking, unlike Fd.
+	err = connection.Control(func(fd uintptr) {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, argument)
+		if errno != 0 {
+			ioctlErr = errno
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return ioctlErr
+}
+
+// openPty returns the master and the slave end of a new pseudo-terminal.
+func openPty() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var unlock int32
+	if err = ioctl(master, syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		_ = master.Close()
+		return nil, nil, err
+	}
+	var number uint32
+	if err = ioctl(master, syscall.TIOCGPTN, uintptr(unsafe.Pointer(&number))); err != nil {
+		_ = master.Close()
+		return nil, nil, err
+	}
+	slave, err := os.OpenFile("/dev/pts/"+strconv.FormatUint(uint64(number), 10), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		_ = master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+func setWindowSize(master *os.File, columns int, rows int) error {
+	size := struct {
+		rows    uint16
+		columns uint16
+		x       uint16
+		y       uint16
+	}{rows: uint16(rows), columns: uint16(columns)}
+	return ioctl(master, syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&size)))
+}
+
+// ptyClosed reports the error reading the master returns once every slave
+// descriptor was closed.
+func ptyClosed(err error) bool {
+	pathErr, ok := err.(*os.PathError)
+	return ok && pathErr.Err == syscall.EIO
+}
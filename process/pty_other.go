@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import (
+	"errors"
+	"os"
+)
+
+var errPtyUnsupported = errors.New("pseudo-terminals are only supported on linux")
+
+func openPty() (*os.File, *os.File, error) {
+	return nil, nil, errPtyUnsupported
+}
+
+func setWindowSize(master *os.File, columns int, rows int) error {
+	return errPtyUnsupported
+}
+
+func ptyClosed(err error) bool {
+	return false
+}
@@ -0,0 +1,237 @@
+package process
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/vvhq/exorsus/configuration"
+	"github.com/vvhq/exorsus/status"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+)
+
+const SourceMemory string = "memory"
+const SourceDisk string = "disk"
+
+const searchCheckInterval int = 256
+
+type SearchQuery struct {
+	Pattern    *regexp.Regexp
+	Apps       []string
+	Since      time.Time
+	Context    int
+	MaxResults int
+	Timeout    time.Duration
+	Disk       bool
+}
+
+type SearchMatch struct {
+	Application string    `json:"application"`
+	Stream      string    `json:"stream"`
+	Time        time.Time `json:"time"`
+	Level       string    `json:"level"`
+	Line        string    `json:"line"`
+	Source      string    `json:"source"`
+	Before      []string  `json:"before"`
+	After       []string  `json:"after"`
+}
+
+type SearchResult struct {
+	Matches   []SearchMatch `json:"matches"`
+	Truncated bool          `json:"truncated"`
+	TimedOut  bool          `json:"timed_out"`
+}
+
+// searcher carries the limits shared by all processes of a single search.
+type searcher struct {
+	query    SearchQuery
+	deadline time.Time
+	scanned  int
+	result   SearchResult
+}
+
+func (searcher *searcher) done() bool {
+	if searcher.result.Truncated || searcher.result.TimedOut {
+		return true
+	}
+	searcher.scanned++
+	if searcher.scanned%searchCheckInterval == 0 && time.Now().After(searcher.deadline) {
+		searcher.result.TimedOut = true
+		return true
+	}
+	return false
+}
+
+func (searcher *searcher) add(match SearchMatch) {
+	searcher.result.Matches = append(searcher.result.Matches, match)
+	if len(searcher.result.Matches) >= searcher.query.MaxResults {
+		searcher.result.Truncated = true
+	}
+}
+
+func (searcher *searcher) searchItems(name string, items []status.Item) {
+	for idx, item := range items {
+		if searcher.done() {
+			return
+		}
+		if item.Time.Before(searcher.query.Since) || !searcher.query.Pattern.MatchString(item.Line) {
+			continue
+		}
+		match := SearchMatch{
+			Application: name,
+			Stream:      item.Stream,
+			Time:        item.Time,
+			Level:       item.Level,
+			Line:        item.Line,
+			Source:      SourceMemory,
+			Before:      []string{},
+			After:       []string{}}
+		for before := idx - searcher.query.Context; before < idx; before++ {
+			if before >= 0 {
+				match.Before = append(match.Before, items[before].Line)
+			}
+		}
+		for after := idx + 1; after <= idx+searcher.query.Context && after < len(items); after++ {
+			match.After = append(match.After, items[after].Line)
+		}
+		searcher.add(match)
+	}
+}
+
+// searchDisk scans the tail of the application JSON log for lines older than
+// the in-memory buffers, so the same line is not reported twice.
+func (searcher *searcher) searchDisk(name string, logPath string, until time.Time) {
+	file, err := os.Open(logPath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return
+	}
+	reader := bufio.NewReaderSize(file, 64*1024)
+	if info.Size() > configuration.DefaultSearchMaxDiskBytes {
+		_, err = file.Seek(info.Size()-configuration.DefaultSearchMaxDiskBytes, io.SeekStart)
+		if err != nil {
+			return
+		}
+		_, _ = reader.ReadString('\n')
+	}
+	var before []string
+	var open []*SearchMatch
+	for !searcher.done() {
+		raw, err := reader.ReadBytes('\n')
+		if len(raw) > 0 {
+			item, ok := parseStdLog(raw)
+			if ok {
+				if !item.Time.Before(until) {
+					break
+				}
+				for _, match := range open {
+					match.After = append(match.After, item.Line)
+				}
+				for len(open) > 0 && len(open[0].After) >= searcher.query.Context {
+					searcher.add(*open[0])
+					open = open[1:]
+				}
+				if !item.Time.Before(searcher.query.Since) && searcher.query.Pattern.MatchString(item.Line) {
+					match := &SearchMatch{
+						Application: name,
+						Stream:      item.Stream,
+						Time:        item.Time,
+						Level:       item.Level,
+						Line:        item.Line,
+						Source:      SourceDisk,
+						Before:      append([]string{}, before...),
+						After:       []string{}}
+					if searcher.query.Context == 0 {
+						searcher.add(*match)
+					} else {
+						open = append(open, match)
+					}
+				}
+				if searcher.query.Context > 0 {
+					before = append(before, item.Line)
+					if len(before) > searcher.query.Context {
+						before = before[1:]
+					}
+				}
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	for _, match := range open {
+		if searcher.result.Truncated {
+			break
+		}
+		searcher.add(*match)
+	}
+}
+
+// parseStdLog reads a line written by Process.writeStdLog back into an item.
+func parseStdLog(raw []byte) (status.Item, bool) {
+	var fields map[string]interface{}
+	if json.Unmarshal(raw, &fields) != nil {
+		return status.Item{}, false
+	}
+	item := status.Item{Stream: status.StreamStdOut}
+	timestamp, _ := fields["time"].(string)
+	parsed, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return status.Item{}, false
+	}
+	item.Time = parsed
+	item.Level, _ = fields["level"].(string)
+	if stream, ok := fields["stream"].(string); ok {
+		item.Stream = stream
+	} else if item.Level == status.LevelError {
+		item.Stream = status.StreamStdErr
+	}
+	if line, ok := fields["item"].(string); ok {
+		item.Line = line
+	} else {
+		item.Line, _ = fields["msg"].(string)
+	}
+	if item.Level == "warning" {
+		item.Level = status.LevelWarn
+	}
+	return item, true
+}
+
+func (manager *Manager) Search(query SearchQuery) SearchResult {
+	searcher := &searcher{query: query, deadline: time.Now().Add(query.Timeout), result: SearchResult{Matches: []SearchMatch{}}}
+	apps := make(map[string]bool, len(query.Apps))
+	for _, name := range query.Apps {
+		apps[name] = true
+	}
+	processes := manager.List()
+	sort.Slice(processes, func(i, j int) bool {
+		return processes[i].Name < processes[j].Name
+	})
+	for _, proc := range processes {
+		if len(apps) > 0 && !apps[proc.Name] {
+			continue
+		}
+		items := proc.GetLogs("", "")
+		if query.Disk && proc.logPath != "" {
+			oldest := time.Now()
+			if len(items) > 0 {
+				oldest = items[0].Time
+			}
+			searcher.searchDisk(proc.Name, proc.logPath, oldest)
+		}
+		searcher.searchItems(proc.Name, items)
+		if searcher.result.Truncated || searcher.result.TimedOut {
+			break
+		}
+	}
+	sort.SliceStable(searcher.result.Matches, func(i, j int) bool {
+		return searcher.result.Matches[i].Time.Before(searcher.result.Matches[j].Time)
+	})
+	return searcher.result
+}
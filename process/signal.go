@@ -0,0 +1,81 @@
+package process
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var ErrUnknownSignal = errors.New("unknown signal")
+var ErrNotRunning = errors.New("process not running")
+
+// signals lists the signals which may be sent to processes by name.
+var signals = map[string]syscall.Signal{
+	"HUP":   syscall.SIGHUP,
+	"INT":   syscall.SIGINT,
+	"QUIT":  syscall.SIGQUIT,
+	"KILL":  syscall.SIGKILL,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"ALRM":  syscall.SIGALRM,
+	"TERM":  syscall.SIGTERM,
+	"CONT":  syscall.SIGCONT,
+	"STOP":  syscall.SIGSTOP,
+	"TSTP":  syscall.SIGTSTP,
+	"TTIN":  syscall.SIGTTIN,
+	"TTOU":  syscall.SIGTTOU,
+	"WINCH": syscall.SIGWINCH,
+}
+
+// terminating reports the signals an operator sends to end a process, whose
+// exit is then expected and not a crash.
+func terminating(signal syscall.Signal) bool {
+	switch signal {
+	case syscall.SIGTERM, syscall.SIGKILL, syscall.SIGINT, syscall.SIGQUIT:
+		return true
+	}
+	return false
+}
+
+// ParseSignal accepts a signal name with or without the SIG prefix, in any
+// case, or the number of one of the known signals.
+func ParseSignal(name string) (syscall.Signal, error) {
+	name = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "SIG")
+	if signal, ok := signals[name]; ok {
+		return signal, nil
+	}
+	if number, err := strconv.Atoi(name); err == nil {
+		for _, signal := range signals {
+			if int(signal) == number {
+				return signal, nil
+			}
+		}
+	}
+	return 0, ErrUnknownSignal
+}
+
+// SignalName returns the name of the signal with the SIG prefix.
+func SignalName(signal syscall.Signal) string {
+	for name, known := range signals {
+		if known == signal {
+			return "SIG" + name
+		}
+	}
+	return strconv.Itoa(int(signal))
+}
+
+// Signal sends the signal to the running process, or to its process group
+// when the application runs in its own one.
+func (process *Process) Signal(signal syscall.Signal) error {
+	return process.submit(command{action: actionSignal, signal: signal})
+}
+
+// kill signals the process or, for applications with ProcessGroup, every
+// process of its group.
+func (process *Process) kill(signal syscall.Signal) error {
+	if process.app.ProcessGroup {
+		return syscall.Kill(-process.command.Process.Pid, signal)
+	}
+	return process.command.Process.Signal(signal)
+}
@@ -0,0 +1,102 @@
+package process
+
+import (
+	"errors"
+	"github.com/vvhq/exorsus/configuration"
+	"github.com/vvhq/exorsus/status"
+	"os"
+	"syscall"
+	"time"
+)
+
+var ErrStdinDisabled = errors.New("stdin not enabled")
+var ErrStdinClosed = errors.New("stdin closed")
+
+// stdinWriteTimeout bounds a write to a process which does not read its stdin.
+const stdinWriteTimeout time.Duration = 10 * time.Second
+
+// StdinEnabled reports whether the application takes input through the API;
+// event listeners keep their stdin for events and tty applications take
+// input through their terminal.
+func (process *Process) StdinEnabled() bool {
+	return process.app.Stdin == configuration.StdinPipe && !process.app.Listener.Enabled && !process.app.Tty
+}
+
+// WriteStdin writes to the stdin of the running process. Writes are not
+// interleaved with each other; they hold stdinWriteLock rather than
+// stdinLock, so releaseStdin can end a blocked write.
+func (process *Process) WriteStdin(data []byte) (int, error) {
+	process.stdinWriteLock.Lock()
+	defer process.stdinWriteLock.Unlock()
+	file, err := process.currentStdin()
+	if err != nil {
+		return 0, err
+	}
+	_ = file.SetWriteDeadline(time.Now().Add(stdinWriteTimeout))
+	written, err := file.Write(data)
+	if errors.Is(err, os.ErrClosed) || errors.Is(err, syscall.EPIPE) {
+		err = ErrStdinClosed
+	}
+	return written, err
+}
+
+// CheckStdin returns the error a write to stdin would fail with right now.
+func (process *Process) CheckStdin() error {
+	_, err := process.currentStdin()
+	return err
+}
+
+// CloseStdin closes the stdin of the running process, so it reads EOF; it
+// stays closed until the process is started again.
+func (process *Process) CloseStdin() error {
+	if err := process.CheckStdin(); err != nil {
+		return err
+	}
+	process.releaseStdin()
+	return nil
+}
+
+func (process *Process) currentStdin() (*os.File, error) {
+	if !process.StdinEnabled() {
+		return nil, ErrStdinDisabled
+	}
+	process.stdinLock.Lock()
+	defer process.stdinLock.Unlock()
+	if process.stdin == nil {
+		if process.status.GetState() != status.Started {
+			return nil, ErrNotRunning
+		}
+		return nil, ErrStdinClosed
+	}
+	return process.stdin, nil
+}
+
+// openStdin makes the pipe for the stdin of the next run and returns its read
+// end, or nil when the pipe can not be created.
+func (process *Process) openStdin() *os.File {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		process.logger.
+			WithField("source", "process").
+			WithField("process", process.Name).
+			WithField("error", err.Error()).
+			Error("Can not create stdin pipe")
+		return nil
+	}
+	process.stdinLock.Lock()
+	defer process.stdinLock.Unlock()
+	process.stdin = writer
+	return reader
+}
+
+// releaseStdin closes the write end of the pipe, which also ends a write
+// blocked on it.
+func (process *Process) releaseStdin() {
+	process.stdinLock.Lock()
+	file := process.stdin
+	process.stdin = nil
+	process.stdinLock.Unlock()
+	if file != nil {
+		_ = file.Close()
+	}
+}
@@ -0,0 +1,221 @@
+package process
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var ErrTtyDisabled = errors.New("tty not enabled")
+var ErrAttachBusy = errors.New("terminal attached by another writer")
+var ErrReadOnly = errors.New("attached read-only")
+var ErrDetached = errors.New("terminal detached")
+
+const defaultTerminalColumns int = 80
+const defaultTerminalRows int = 24
+
+// attachmentBuffer is the number of output chunks an attached client may
+// lag behind before it is detached.
+const attachmentBuffer int = 256
+
+// terminal is the pseudo-terminal of one run of a tty application. Its
+// master is read as the stdout of the process; what is read is also sent
+// raw to every attached client.
+type terminal struct {
+	master  *os.File
+	clients map[*Attachment]struct{}
+	writer  *Attachment
+	closed  bool
+	lock    sync.Mutex
+}
+
+// Read reads from the master for line capture, which drops the carriage
+// returns the terminal adds to line breaks.
+func (terminal *terminal) Read(buffer []byte) (int, error) {
+	count, err := terminal.master.Read(buffer)
+	if count > 0 {
+		terminal.broadcast(buffer[:count])
+		kept := 0
+		for idx := 0; idx < count; idx++ {
+			if buffer[idx] != '\r' {
+				buffer[kept] = buffer[idx]
+				kept++
+			}
+		}
+		count = kept
+	}
+	if err != nil && ptyClosed(err) {
+		err = io.EOF
+	}
+	return count, err
+}
+
+func (terminal *terminal) Close() error {
+	return terminal.master.Close()
+}
+
+func (terminal *terminal) broadcast(data []byte) {
+	terminal.lock.Lock()
+	defer terminal.lock.Unlock()
+	for attachment := range terminal.clients {
+		chunk := append([]byte(nil), data...)
+		select {
+		case attachment.output <- chunk:
+		default:
+			terminal.remove(attachment)
+		}
+	}
+}
+
+// detachAll ends every attachment once the process exited.
+func (terminal *terminal) detachAll() {
+	terminal.lock.Lock()
+	defer terminal.lock.Unlock()
+	terminal.closed = true
+	for attachment := range terminal.clients {
+		terminal.remove(attachment)
+	}
+}
+
+func (terminal *terminal) remove(attachment *Attachment) {
+	delete(terminal.clients, attachment)
+	if terminal.writer == attachment {
+		terminal.writer = nil
+	}
+	attachment.once.Do(func() {
+		close(attachment.done)
+	})
+}
+
+// Attachment is a client attached to the terminal of a process. Output
+// delivers what the process writes to the terminal.
+type Attachment struct {
+	Output   <-chan []byte
+	output   chan []byte
+	done     chan struct{}
+	once     sync.Once
+	terminal *terminal
+	writer   bool
+}
+
+// Done is closed when the attachment ends: on Detach, when the process
+// exits, or when the client fell too far behind.
+func (attachment *Attachment) Done() <-chan struct{} {
+	return attachment.done
+}
+
+// Write sends input to the terminal; only the writer may do it.
+func (attachment *Attachment) Write(data []byte) (int, error) {
+	if !attachment.writer {
+		return 0, ErrReadOnly
+	}
+	select {
+	case <-attachment.done:
+		return 0, ErrDetached
+	default:
+	}
+	_ = attachment.terminal.master.SetWriteDeadline(time.Now().Add(stdinWriteTimeout))
+	return attachment.terminal.master.Write(data)
+}
+
+// Resize sets the window size of the terminal; only the writer may do it.
+func (attachment *Attachment) Resize(columns int, rows int) error {
+	if !attachment.writer {
+		return ErrReadOnly
+	}
+	if columns <= 0 || rows <= 0 || columns > 0xffff || rows > 0xffff {
+		return errors.New("invalid window size")
+	}
+	return setWindowSize(attachment.terminal.master, columns, rows)
+}
+
+func (attachment *Attachment) Detach() {
+	attachment.terminal.lock.Lock()
+	defer attachment.terminal.lock.Unlock()
+	attachment.terminal.remove(attachment)
+}
+
+// TtyEnabled reports whether the application runs under a pseudo-terminal;
+// event listeners keep their stdin and stdout for events.
+func (process *Process) TtyEnabled() bool {
+	return process.app.Tty && !process.app.Listener.Enabled
+}
+
+// Attach attaches a client to the terminal of the running process. Only one
+// client at a time may attach as the writer.
+func (process *Process) Attach(writer bool) (*Attachment, error) {
+	if !process.TtyEnabled() {
+		return nil, ErrTtyDisabled
+	}
+	process.terminalLock.Lock()
+	current := process.terminal
+	process.terminalLock.Unlock()
+	if current == nil {
+		return nil, ErrNotRunning
+	}
+	current.lock.Lock()
+	defer current.lock.Unlock()
+	if current.closed {
+		return nil, ErrNotRunning
+	}
+	if writer && current.writer != nil {
+		return nil, ErrAttachBusy
+	}
+	output := make(chan []byte, attachmentBuffer)
+	attachment := &Attachment{Output: output, output: output, done: make(chan struct{}), terminal: current, writer: writer}
+	current.clients[attachment] = struct{}{}
+	if writer {
+		current.writer = attachment
+	}
+	return attachment, nil
+}
+
+// openTerminal makes the pseudo-terminal for the next run and returns its
+// slave end, or nil when it can not be created.
+func (process *Process) openTerminal() (*terminal, *os.File) {
+	master, slave, err := openPty()
+	if err == nil {
+		err = setWindowSize(master, defaultTerminalColumns, defaultTerminalRows)
+		if err != nil {
+			_ = master.Close()
+			_ = slave.Close()
+		}
+	}
+	if err != nil {
+		process.logger.
+			WithField("source", "process").
+			WithField("process", process.Name).
+			WithField("error", err.Error()).
+			Error("Can not create pseudo-terminal")
+		return nil, nil
+	}
+	current := &terminal{master: master, clients: make(map[*Attachment]struct{})}
+	process.terminalLock.Lock()
+	defer process.terminalLock.Unlock()
+	process.terminal = current
+	return current, slave
+}
+
+// releaseTerminal detaches all clients; the master is closed by the reader
+// of the output once it is drained.
+func (process *Process) releaseTerminal() {
+	process.terminalLock.Lock()
+	current := process.terminal
+	process.terminal = nil
+	process.terminalLock.Unlock()
+	if current != nil {
+		current.detachAll()
+	}
+}
+
+// ttyAttributes makes the child a session leader with the terminal as its
+// controlling terminal; the session is its own process group as well.
+func ttyAttributes(attributes *syscall.SysProcAttr) {
+	attributes.Setsid = true
+	attributes.Setctty = true
+	attributes.Ctty = 0
+	attributes.Setpgid = false
+}
@@ -0,0 +1,155 @@
+package rest
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/vvhq/exorsus/process"
+	"github.com/vvhq/exorsus/websocket"
+	"net/http"
+	"strconv"
+)
+
+const attachResize string = "resize"
+const attachInput string = "input"
+
+// AttachControl is a text message of an attached client. Binary messages
+// are sent to the terminal as they are.
+type AttachControl struct {
+	Type    string `json:"type"`
+	Columns int    `json:"cols"`
+	Rows    int    `json:"rows"`
+	Data    string `json:"data"`
+}
+
+// attachStatus maps errors of attaching to HTTP status codes.
+func attachStatus(err error) int {
+	switch err {
+	case process.ErrTtyDisabled, process.ErrNotRunning, process.ErrAttachBusy:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// attach attaches a websocket client to the terminal of a tty application.
+// Output is sent as binary messages; with readonly=true the client only
+// watches and does not take the writer lock.
+func (service *Service) attach(responseWriter http.ResponseWriter, request *http.Request) {
+	name := mux.Vars(request)["name"]
+	proc, ok := service.findProcess(name)
+	if !ok {
+		service.httpError(responseWriter, request, http.StatusNotFound, "application not found")
+		return
+	}
+	readOnly := false
+	if value := request.URL.Query().Get("readonly"); value != "" {
+		var err error
+		readOnly, err = strconv.ParseBool(value)
+		if err != nil {
+			service.httpError(responseWriter, request, http.StatusBadRequest, "invalid readonly parameter")
+			return
+		}
+	}
+	columns, rows := 0, 0
+	for parameter, target := range map[string]*int{"cols": &columns, "rows": &rows} {
+		if value := request.URL.Query().Get(parameter); value != "" {
+			number, err := strconv.Atoi(value)
+			if err != nil || number <= 0 {
+				service.httpError(responseWriter, request, http.StatusBadRequest, "invalid "+parameter+" parameter")
+				return
+			}
+			*target = number
+		}
+	}
+	if !websocket.IsUpgrade(request) {
+		service.httpError(responseWriter, request, http.StatusBadRequest, "websocket handshake expected")
+		return
+	}
+	if !websocket.CheckOrigin(request, service.config.WebSocketOrigins) {
+		service.httpError(responseWriter, request, http.StatusForbidden, websocket.ErrOrigin.Error())
+		return
+	}
+	attachment, err := proc.Attach(!readOnly)
+	if err != nil {
+		service.httpError(responseWriter, request, attachStatus(err), err.Error())
+		return
+	}
+	defer attachment.Detach()
+	if !readOnly && columns > 0 && rows > 0 {
+		if err := attachment.Resize(columns, rows); err != nil {
+			service.httpError(responseWriter, request, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	conn, err := websocket.Upgrade(responseWriter, request, service.config.WebSocketOrigins)
+	if err != nil {
+		return
+	}
+	reader := make(chan error, 1)
+	go func() {
+		reader <- service.readAttachment(conn, attachment)
+	}()
+	for {
+		select {
+		case chunk := <-attachment.Output:
+			if err := conn.WriteMessage(websocket.BinaryMessage, chunk); err != nil {
+				_ = conn.Close()
+				<-reader
+				return
+			}
+		case <-attachment.Done():
+			// Send what the process wrote before it exited.
+			for drained := false; !drained; {
+				select {
+				case chunk := <-attachment.Output:
+					_ = conn.WriteMessage(websocket.BinaryMessage, chunk)
+				default:
+					drained = true
+				}
+			}
+			_ = conn.CloseWithReason(websocket.CloseNormal, "detached")
+			<-reader
+			return
+		case <-service.closing:
+			_ = conn.CloseWithReason(websocket.CloseGoingAway, "exorsus stopping")
+			<-reader
+			return
+		case err := <-reader:
+			if err != nil && err != websocket.ErrClosed {
+				_ = conn.CloseWithReason(websocket.CloseInternalError, err.Error())
+			} else {
+				_ = conn.Close()
+			}
+			return
+		}
+	}
+}
+
+// readAttachment passes the messages of the client to the terminal until
+// the client goes away or a message can not be handled.
+func (service *Service) readAttachment(conn *websocket.Conn, attachment *process.Attachment) error {
+	for {
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if messageType == websocket.BinaryMessage {
+			if _, err := attachment.Write(message); err != nil {
+				return err
+			}
+			continue
+		}
+		control := AttachControl{}
+		if err := json.Unmarshal(message, &control); err != nil {
+			return err
+		}
+		switch control.Type {
+		case attachResize:
+			err = attachment.Resize(control.Columns, control.Rows)
+		case attachInput:
+			_, err = attachment.Write([]byte(control.Data))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
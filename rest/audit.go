@@ -0,0 +1,230 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/vvhq/exorsus/application"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const auditKey contextKey = "audit"
+
+const AuditSuccess string = "success"
+const AuditFailure string = "failure"
+const AuditDenied string = "denied"
+
+const auditCreate string = "create"
+const auditUpdate string = "update"
+const auditDelete string = "delete"
+const auditStdin string = "stdin"
+const auditAttach string = "attach"
+const auditExec string = "exec"
+
+// redacted replaces environment values in the audit log.
+const redacted string = "[redacted]"
+
+// Change is the old and new value of an application field.
+type Change struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// AuditRecord is one line of the audit log. Previous and Current are the
+// application definitions before and after the request, and Diff lists the
+// fields an update changed. Environment values are redacted; Diff names the
+// variables which changed as "environment.<name>".
+type AuditRecord struct {
+	Time        time.Time                `json:"time"`
+	Action      string                   `json:"action"`
+	Application string                   `json:"application,omitempty"`
+	Token       string                   `json:"token,omitempty"`
+	CommonName  string                   `json:"common_name,omitempty"`
+	Role        string                   `json:"role,omitempty"`
+	Remote      string                   `json:"remote"`
+	Method      string                   `json:"method"`
+	Path        string                   `json:"path"`
+	Parameters  map[string]string        `json:"parameters,omitempty"`
+	Previous    *application.Application `json:"previous,omitempty"`
+	Current     *application.Application `json:"current,omitempty"`
+	Diff        map[string]Change        `json:"diff,omitempty"`
+	Operation   string                   `json:"operation,omitempty"`
+	Status      int                      `json:"status"`
+	Result      string                   `json:"result"`
+	Error       string                   `json:"error,omitempty"`
+}
+
+// auditAction names the audited action of a route, or returns "" for routes
+// which change nothing.
+func auditAction(method string, template string) string {
+	switch template {
+	case "/applications/":
+		if method == http.MethodPost {
+			return auditCreate
+		}
+	case "/applications/{name}":
+		switch method {
+		case http.MethodPut:
+			return auditUpdate
+		case http.MethodDelete:
+			return auditDelete
+		}
+	case "/stdin/{name}":
+		return auditStdin
+	case "/attach/{name}":
+		return auditAttach
+	case "/applications/{name}/exec":
+		return auditExec
+	}
+	if strings.HasPrefix(template, "/actions/") {
+		return strings.SplitN(strings.TrimPrefix(template, "/actions/"), "/", 2)[0]
+	}
+	return ""
+}
+
+// auditRecord returns the record of the request, or nil when the request is
+// not audited; handlers add what only they know to it.
+func auditRecord(request *http.Request) *AuditRecord {
+	record, _ := request.Context().Value(auditKey).(*AuditRecord)
+	return record
+}
+
+// audit writes a record for every request which changes applications or
+// processes, including the ones refused by authenticate or authorize, which
+// run after it and add the identity to the record.
+func (service *Service) audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		action := auditAction(request.Method, strings.TrimPrefix(routeTemplate(request), apiPrefix))
+		if action == "" || service.auditLog == nil {
+			next.ServeHTTP(responseWriter, request)
+			return
+		}
+		record := &AuditRecord{
+			Time:        time.Now(),
+			Action:      action,
+			Application: mux.Vars(request)["name"],
+			Remote:      request.RemoteAddr,
+			Method:      request.Method,
+			Path:        request.URL.Path}
+		if commonName, verified := clientCommonName(request.TLS); verified {
+			record.CommonName = commonName
+		}
+		for name, value := range mux.Vars(request) {
+			if name != "name" {
+				record.setParameter(name, value)
+			}
+		}
+		for name, values := range request.URL.Query() {
+			record.setParameter(name, strings.Join(values, ","))
+		}
+		recorder := &statusRecorder{ResponseWriter: responseWriter}
+		next.ServeHTTP(recorder, request.WithContext(context.WithValue(request.Context(), auditKey, record)))
+
+		record.Status = recorder.code
+		if record.Status == 0 {
+			record.Status = http.StatusOK
+		}
+		switch {
+		case record.Status == http.StatusUnauthorized, record.Status == http.StatusForbidden:
+			record.Result = AuditDenied
+		case record.Status >= http.StatusBadRequest:
+			record.Result = AuditFailure
+		default:
+			record.Result = AuditSuccess
+		}
+		if record.Previous != nil && record.Current != nil {
+			record.Diff = diffApplications(*record.Previous, *record.Current)
+		}
+		record.Previous = redactApplication(record.Previous)
+		record.Current = redactApplication(record.Current)
+		err := service.auditLog.Write(record)
+		if err != nil {
+			service.logger.
+				WithField("source", "rest").
+				WithField("action", record.Action).
+				WithField("process", record.Application).
+				WithField("error", err.Error()).
+				Error("Can not write audit log")
+		}
+	})
+}
+
+func (record *AuditRecord) setParameter(name string, value string) {
+	if record.Parameters == nil {
+		record.Parameters = make(map[string]string)
+	}
+	record.Parameters[name] = value
+}
+
+// diffApplications compares the JSON fields of two application definitions;
+// the environment is compared by variable, without the values.
+func diffApplications(previous application.Application, current application.Application) map[string]Change {
+	previousFields := applicationFields(previous)
+	currentFields := applicationFields(current)
+	delete(previousFields, "environment")
+	delete(currentFields, "environment")
+	diff := diffEnvironment(previous.Environment, current.Environment)
+	for name, value := range currentFields {
+		if !reflect.DeepEqual(previousFields[name], value) {
+			diff[name] = Change{Old: previousFields[name], New: value}
+		}
+	}
+	for name, value := range previousFields {
+		if _, ok := currentFields[name]; !ok {
+			diff[name] = Change{Old: value}
+		}
+	}
+	return diff
+}
+
+func diffEnvironment(previous []application.Environment, current []application.Environment) map[string]Change {
+	previousValues := make(map[string]string)
+	for _, env := range previous {
+		previousValues[env.Name] = env.Value
+	}
+	currentValues := make(map[string]string)
+	for _, env := range current {
+		currentValues[env.Name] = env.Value
+	}
+	diff := make(map[string]Change)
+	for name, value := range currentValues {
+		previousValue, ok := previousValues[name]
+		if !ok {
+			diff["environment."+name] = Change{New: redacted}
+		} else if previousValue != value {
+			diff["environment."+name] = Change{Old: redacted, New: redacted}
+		}
+	}
+	for name := range previousValues {
+		if _, ok := currentValues[name]; !ok {
+			diff["environment."+name] = Change{Old: redacted}
+		}
+	}
+	return diff
+}
+
+// redactApplication returns a copy of the application without environment
+// values, or nil for nil.
+func redactApplication(app *application.Application) *application.Application {
+	if app == nil {
+		return nil
+	}
+	redactedApp := *app
+	redactedApp.Environment = nil
+	for _, env := range app.Environment {
+		redactedApp.Environment = append(redactedApp.Environment, application.Environment{Name: env.Name, Value: redacted})
+	}
+	return &redactedApp
+}
+
+func applicationFields(app application.Application) map[string]interface{} {
+	fields := make(map[string]interface{})
+	jsonApp, err := json.Marshal(app)
+	if err == nil {
+		_ = json.Unmarshal(jsonApp, &fields)
+	}
+	return fields
+}
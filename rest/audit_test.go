@@ -0,0 +1,121 @@
+package rest
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/vvhq/exorsus/application"
+	"github.com/vvhq/exorsus/logging"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffApplications(t *testing.T) {
+	previous := application.Application{Name: "web", Command: "/bin/web", Environment: []application.Environment{
+		{Name: "KEEP", Value: "same"}, {Name: "SECRET", Value: "old"}, {Name: "GONE", Value: "x"}}}
+	current := application.Application{Name: "web", Command: "/bin/web2", Environment: []application.Environment{
+		{Name: "KEEP", Value: "same"}, {Name: "SECRET", Value: "new"}, {Name: "ADDED", Value: "y"}}}
+
+	want := map[string]Change{
+		"command":            {Old: "/bin/web", New: "/bin/web2"},
+		"environment.SECRET": {Old: redacted, New: redacted},
+		"environment.GONE":   {Old: redacted},
+		"environment.ADDED":  {New: redacted},
+	}
+	if diff := diffApplications(previous, current); !reflect.DeepEqual(diff, want) {
+		t.Errorf("diff = %+v, want %+v", diff, want)
+	}
+}
+
+func TestRedactApplication(t *testing.T) {
+	app := &application.Application{Name: "web", Environment: []application.Environment{{Name: "SECRET", Value: "hunter2"}}}
+	redactedApp := redactApplication(app)
+	if redactedApp.Environment[0] != (application.Environment{Name: "SECRET", Value: redacted}) {
+		t.Errorf("environment = %+v, want the value redacted", redactedApp.Environment)
+	}
+	if app.Environment[0].Value != "hunter2" {
+		t.Error("redactApplication changed the application")
+	}
+	if redactApplication(nil) != nil {
+		t.Error("redactApplication(nil) is not nil")
+	}
+}
+
+func readAudit(t *testing.T, path string) []AuditRecord {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var records []AuditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		record := AuditRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestAudit(t *testing.T) {
+	service := authService(t)
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	service.auditLog = logging.NewAuditLog(auditPath, 1, 1, 1, false)
+	defer service.auditLog.Close()
+	router := mux.NewRouter()
+	router.Use(service.audit, service.authenticate, service.authorize)
+	router.HandleFunc("/applications/{name}", func(responseWriter http.ResponseWriter, request *http.Request) {
+		record := auditRecord(request)
+		record.Previous = &application.Application{Name: "web", Environment: []application.Environment{{Name: "SECRET", Value: "hunter2"}}}
+		record.Current = &application.Application{Name: "web", Environment: []application.Environment{{Name: "SECRET", Value: "swordfish"}}}
+		responseWriter.WriteHeader(http.StatusOK)
+	}).Methods("PUT")
+
+	for _, token := range []string{"", "reader-token", "admin-token"} {
+		request := httptest.NewRequest(http.MethodPut, "/applications/web", nil)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	records := readAudit(t, auditPath)
+	if len(records) != 3 {
+		t.Fatalf("%d audit records, want 3", len(records))
+	}
+	want := []struct {
+		token  string
+		status int
+		result string
+	}{
+		{"", http.StatusUnauthorized, AuditDenied},
+		{"dashboard", http.StatusForbidden, AuditDenied},
+		{"root", http.StatusOK, AuditSuccess},
+	}
+	for index, record := range records {
+		if record.Token != want[index].token || record.Status != want[index].status || record.Result != want[index].result {
+			t.Errorf("record %d = %s %d %s, want %s %d %s", index, record.Token, record.Status, record.Result,
+				want[index].token, want[index].status, want[index].result)
+		}
+	}
+	success := records[2]
+	if success.Previous.Environment[0].Value != redacted || success.Current.Environment[0].Value != redacted {
+		t.Errorf("environment values are not redacted: %+v %+v", success.Previous.Environment, success.Current.Environment)
+	}
+	if _, ok := success.Diff["environment.SECRET"]; !ok {
+		t.Errorf("diff = %+v, want the changed variable", success.Diff)
+	}
+	raw, _ := ioutil.ReadFile(auditPath)
+	if strings.Contains(string(raw), "hunter2") || strings.Contains(string(raw), "swordfish") {
+		t.Errorf("audit log contains environment values: %s", raw)
+	}
+}
@@ -0,0 +1,313 @@
+package rest
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/vvhq/exorsus/configuration"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+)
+
+type contextKey string
+
+const identityKey contextKey = "identity"
+const socketKey contextKey = "socket"
+
+var roleRanks = map[string]int{configuration.RoleReader: 0, configuration.RoleOperator: 1, configuration.RoleAdmin: 2}
+
+type credential struct {
+	name         string
+	hash         []byte
+	commonName   string
+	role         string
+	applications []string
+}
+
+// Identity describes the authenticated caller of a request.
+type Identity struct {
+	Name         string
+	CommonName   string
+	Role         string
+	Applications []string
+}
+
+func (identity Identity) HasRole(role string) bool {
+	return roleRanks[identity.Role] >= roleRanks[role]
+}
+
+// Allows reports whether the identity may access the named application.
+func (identity Identity) Allows(name string) bool {
+	if len(identity.Applications) == 0 {
+		return true
+	}
+	for _, pattern := range identity.Applications {
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Scoped reports whether the identity is restricted to some applications.
+func (identity Identity) Scoped() bool {
+	return len(identity.Applications) > 0
+}
+
+func RequestIdentity(request *http.Request) (Identity, bool) {
+	identity, ok := request.Context().Value(identityKey).(Identity)
+	return identity, ok
+}
+
+// loadCredentials fails when the token file can not be read, or when no
+// credential is configured for a listener reachable from other hosts.
+// Without credentials, local listeners accept unauthenticated requests;
+// DisableAuth turns authentication off everywhere.
+func (service *Service) loadCredentials() error {
+	service.credentials = nil
+	service.anonymous = false
+	if service.config.DisableAuth {
+		service.anonymous = true
+		service.logger.
+			WithField("source", "rest").
+			Warn("REST authentication disabled by configuration")
+		return nil
+	}
+	tokens, err := service.config.GetTokens()
+	if err != nil {
+		return fmt.Errorf("can not load token file %s: %s", service.config.TokenFile, err.Error())
+	}
+	for _, token := range tokens {
+		hash, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(token.Hash), "sha256:"))
+		if err != nil || (len(hash) == 0 && token.CommonName == "") {
+			service.logger.
+				WithField("source", "rest").
+				WithField("token", token.Name).
+				Error("Skip token with invalid hash")
+			continue
+		}
+		if token.Role != token.GetRole() && token.Role != "" {
+			service.logger.
+				WithField("source", "rest").
+				WithField("token", token.Name).
+				WithField("role", token.Role).
+				Warn("Unknown token role, token is read-only")
+		}
+		service.credentials = append(service.credentials, credential{
+			name:         token.Name,
+			hash:         hash,
+			commonName:   token.CommonName,
+			role:         token.GetRole(),
+			applications: token.Applications})
+	}
+	if len(service.credentials) > 0 {
+		return nil
+	}
+	if !service.local() {
+		return errors.New("no valid API tokens configured for a listener reachable from other hosts, configure Tokens or TokenFile or set DisableAuth")
+	}
+	service.anonymous = true
+	service.logger.
+		WithField("source", "rest").
+		Warn("No valid API tokens configured, REST authentication disabled on the local listeners")
+	return nil
+}
+
+// local reports whether REST only listens on loopback addresses and unix
+// sockets.
+func (service *Service) local() bool {
+	if service.port <= 0 {
+		return true
+	}
+	if service.config.ListenAddress == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(service.config.ListenAddress)
+	return ip != nil && ip.IsLoopback()
+}
+
+// findCredential compares the token hash against every credential, so the
+// time taken does not depend on which one (if any) matched.
+func (service *Service) findCredential(token string) (credential, bool) {
+	hash, _ := hex.DecodeString(configuration.HashToken(token))
+	var found credential
+	matched := 0
+	for _, candidate := range service.credentials {
+		if subtle.ConstantTimeCompare(hash, candidate.hash) == 1 {
+			found = candidate
+			matched = 1
+		}
+	}
+	return found, matched == 1
+}
+
+func (service *Service) findCommonName(commonName string) (credential, bool) {
+	for _, candidate := range service.credentials {
+		if candidate.commonName != "" && candidate.commonName == commonName {
+			return candidate, true
+		}
+	}
+	return credential{}, false
+}
+
+// socketContext marks the connections accepted on the unix socket.
+func socketContext(ctx context.Context, conn net.Conn) context.Context {
+	if conn.LocalAddr().Network() == "unix" {
+		return context.WithValue(ctx, socketKey, true)
+	}
+	return ctx
+}
+
+// trustedSocket reports requests over the unix socket when its file
+// permissions are the access control, set by ListenSocketAuth.
+func (service *Service) trustedSocket(request *http.Request) bool {
+	socket, _ := request.Context().Value(socketKey).(bool)
+	return socket && service.config.GetListenSocketAuth() == configuration.ListenSocketAuthNone
+}
+
+func (service *Service) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		if service.anonymous || service.public(request) {
+			next.ServeHTTP(responseWriter, request)
+			return
+		}
+		if service.trustedSocket(request) {
+			identity := Identity{Name: "socket", Role: service.config.GetListenSocketRole()}
+			if record := auditRecord(request); record != nil {
+				record.Token = identity.Name
+				record.Role = identity.Role
+			}
+			next.ServeHTTP(responseWriter, request.WithContext(context.WithValue(request.Context(), identityKey, identity)))
+			return
+		}
+		// A verified client certificate only counts when a token maps its CN.
+		commonName, verified := clientCommonName(request.TLS)
+		var found credential
+		ok := false
+		authorization := request.Header.Get("Authorization")
+		if len(authorization) >= 7 && strings.EqualFold(authorization[:7], "bearer ") {
+			found, ok = service.findCredential(strings.TrimSpace(authorization[7:]))
+			if !ok {
+				service.logger.
+					WithField("source", "rest").
+					WithField("remote", request.RemoteAddr).
+					WithField("request", request.RequestURI).
+					Warn("Invalid API token")
+				responseWriter.Header().Set("WWW-Authenticate", "Bearer realm=\"exorsus\", error=\"invalid_token\"")
+				service.httpError(responseWriter, request, http.StatusUnauthorized, "invalid token")
+				return
+			}
+		} else if verified {
+			found, ok = service.findCommonName(commonName)
+		}
+		if !ok {
+			responseWriter.Header().Set("WWW-Authenticate", "Bearer realm=\"exorsus\"")
+			service.httpError(responseWriter, request, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		identity := Identity{Name: found.name, Role: found.role, Applications: found.applications}
+		if verified {
+			identity.CommonName = commonName
+		}
+		if record := auditRecord(request); record != nil {
+			record.Token = identity.Name
+			record.Role = identity.Role
+		}
+		ctx := context.WithValue(request.Context(), identityKey, identity)
+		next.ServeHTTP(responseWriter, request.WithContext(ctx))
+	})
+}
+
+// routeTemplate returns the path template of the matched route.
+func routeTemplate(request *http.Request) string {
+	template := ""
+	if route := mux.CurrentRoute(request); route != nil {
+		template, _ = route.GetPathTemplate()
+	}
+	return template
+}
+
+// requiredRole maps a route to the least role allowed to call it. Routes
+// which are not listed require admin.
+func requiredRole(method string, template string) string {
+	switch template {
+	case "/version/", "/status/", "/status/{name}", "/logs/search", "/logs/{name}",
+		"/operations/", "/operations/{id}", "/events", "/metrics",
+		"/healthz", "/readyz":
+		return configuration.RoleReader
+	case "/applications/", "/applications/{name}":
+		if method == http.MethodGet {
+			return configuration.RoleReader
+		}
+		return configuration.RoleAdmin
+	case "/actions/start/", "/actions/stop/", "/actions/restart/",
+		"/actions/start/{name}", "/actions/stop/{name}", "/actions/restart/{name}",
+		"/actions/signal/{name}/{signal}", "/stdin/{name}", "/attach/{name}":
+		return configuration.RoleOperator
+	default:
+		return configuration.RoleAdmin
+	}
+}
+
+// namedInBody reports routes which take the application name from the
+// request body; their handlers check it with Service.allowed.
+func namedInBody(method string, template string) bool {
+	return method == http.MethodPost && template == "/applications/"
+}
+
+func (service *Service) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		identity, ok := RequestIdentity(request)
+		if !ok {
+			next.ServeHTTP(responseWriter, request)
+			return
+		}
+		template := strings.TrimPrefix(routeTemplate(request), apiPrefix)
+		role := requiredRole(request.Method, template)
+		applicationName, named := mux.Vars(request)["name"]
+		reason := ""
+		if !identity.HasRole(role) {
+			reason = "role " + role + " required"
+		} else if named && !identity.Allows(applicationName) {
+			reason = "application not allowed"
+		} else if !named && identity.Scoped() && role != configuration.RoleReader && !namedInBody(request.Method, template) {
+			reason = "operation on all applications not allowed"
+		}
+		if reason != "" {
+			service.logger.
+				WithField("source", "rest").
+				WithField("token", identity.Name).
+				WithField("role", identity.Role).
+				WithField("method", request.Method).
+				WithField("request", request.RequestURI).
+				WithField("remote", request.RemoteAddr).
+				WithField("reason", reason).
+				Warn("Access denied")
+			service.httpError(responseWriter, request, http.StatusForbidden, "access denied")
+			return
+		}
+		next.ServeHTTP(responseWriter, request)
+	})
+}
+
+// allowed reports whether the caller may see or change the named application;
+// handlers use it to filter lists and check names taken from request bodies.
+func (service *Service) allowed(request *http.Request, name string) bool {
+	identity, ok := RequestIdentity(request)
+	return !ok || identity.Allows(name)
+}
+
+func (service *Service) public(request *http.Request) bool {
+	switch strings.TrimPrefix(request.URL.Path, apiPrefix) {
+	case "/version/":
+		return service.config.PublicVersion
+	case "/healthz", "/readyz":
+		return service.config.PublicHealth
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package rest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/vvhq/exorsus/configuration"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequiredRole(t *testing.T) {
+	tests := []struct {
+		method   string
+		template string
+		role     string
+	}{
+		{http.MethodGet, "/status/", configuration.RoleReader},
+		{http.MethodGet, "/logs/{name}", configuration.RoleReader},
+		{http.MethodGet, "/metrics", configuration.RoleReader},
+		{http.MethodGet, "/applications/", configuration.RoleReader},
+		{http.MethodGet, "/applications/{name}", configuration.RoleReader},
+		{http.MethodPost, "/applications/", configuration.RoleAdmin},
+		{http.MethodPut, "/applications/{name}", configuration.RoleAdmin},
+		{http.MethodDelete, "/applications/{name}", configuration.RoleAdmin},
+		{http.MethodPost, "/actions/restart/", configuration.RoleOperator},
+		{http.MethodPost, "/actions/stop/{name}", configuration.RoleOperator},
+		{http.MethodPost, "/actions/signal/{name}/{signal}", configuration.RoleOperator},
+		{http.MethodPost, "/stdin/{name}", configuration.RoleOperator},
+		{http.MethodGet, "/attach/{name}", configuration.RoleOperator},
+		{http.MethodPost, "/applications/{name}/exec", configuration.RoleAdmin},
+		{http.MethodGet, "/unknown", configuration.RoleAdmin},
+	}
+	for _, test := range tests {
+		if role := requiredRole(test.method, test.template); role != test.role {
+			t.Errorf("requiredRole(%s, %s) = %s, want %s", test.method, test.template, role, test.role)
+		}
+	}
+}
+
+func TestIdentityAllows(t *testing.T) {
+	identity := Identity{Applications: []string{"web-*", "db"}}
+	for name, want := range map[string]bool{"web-1": true, "db": true, "db-2": false, "api": false} {
+		if identity.Allows(name) != want {
+			t.Errorf("Allows(%s) = %v, want %v", name, !want, want)
+		}
+	}
+	if !(Identity{}).Allows("anything") {
+		t.Error("unscoped identity does not allow every application")
+	}
+}
+
+func authService(t *testing.T) *Service {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	config := &configuration.Configuration{Tokens: []configuration.Token{
+		{Name: "dashboard", Hash: configuration.HashToken("reader-token"), Role: configuration.RoleReader},
+		{Name: "deploy", Hash: configuration.HashToken("operator-token"), Role: configuration.RoleOperator, Applications: []string{"web-*"}},
+		{Name: "root", Hash: "sha256:" + configuration.HashToken("admin-token")},
+		{Name: "ci", CommonName: "ci-runner", Role: configuration.RoleOperator},
+	}}
+	service := &Service{port: 5202, config: config, logger: logger}
+	if err := service.loadCredentials(); err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+func authRouter(service *Service) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(service.authenticate, service.authorize)
+	handler := func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusOK)
+	}
+	router.HandleFunc("/status/", handler).Methods("GET")
+	router.HandleFunc("/applications/", handler).Methods("GET", "POST")
+	router.HandleFunc("/applications/{name}", handler).Methods("PUT")
+	router.HandleFunc("/actions/restart/", handler).Methods("POST")
+	router.HandleFunc("/actions/restart/{name}", handler).Methods("POST")
+	return router
+}
+
+func TestAuthorize(t *testing.T) {
+	router := authRouter(authService(t))
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		code   int
+	}{
+		{"no token", "", http.MethodGet, "/status/", http.StatusUnauthorized},
+		{"invalid token", "wrong", http.MethodGet, "/status/", http.StatusUnauthorized},
+		{"reader reads", "reader-token", http.MethodGet, "/status/", http.StatusOK},
+		{"reader restarts", "reader-token", http.MethodPost, "/actions/restart/web-1", http.StatusForbidden},
+		{"operator restarts own app", "operator-token", http.MethodPost, "/actions/restart/web-1", http.StatusOK},
+		{"operator restarts other app", "operator-token", http.MethodPost, "/actions/restart/db", http.StatusForbidden},
+		{"scoped operator restarts all", "operator-token", http.MethodPost, "/actions/restart/", http.StatusForbidden},
+		{"scoped operator reads all", "operator-token", http.MethodGet, "/applications/", http.StatusOK},
+		{"operator updates", "operator-token", http.MethodPut, "/applications/web-1", http.StatusForbidden},
+		{"admin updates", "admin-token", http.MethodPut, "/applications/db", http.StatusOK},
+		{"admin restarts all", "admin-token", http.MethodPost, "/actions/restart/", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, test.path, nil)
+			if test.token != "" {
+				request.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != test.code {
+				t.Errorf("%s %s = %d, want %d", test.method, test.path, recorder.Code, test.code)
+			}
+		})
+	}
+}
+
+func verifiedRequest(method string, path string, commonName string) *http.Request {
+	request := httptest.NewRequest(method, path, nil)
+	certificate := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certificate}}}
+	return request
+}
+
+func TestAuthenticateClientCertificate(t *testing.T) {
+	router := authRouter(authService(t))
+	tests := []struct {
+		commonName string
+		method     string
+		path       string
+		code       int
+	}{
+		{"ci-runner", http.MethodPost, "/actions/restart/", http.StatusOK},
+		{"ci-runner", http.MethodPut, "/applications/web-1", http.StatusForbidden},
+		{"stranger", http.MethodGet, "/status/", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, verifiedRequest(test.method, test.path, test.commonName))
+		if recorder.Code != test.code {
+			t.Errorf("%s %s as %s = %d, want %d", test.method, test.path, test.commonName, recorder.Code, test.code)
+		}
+	}
+}
+
+func TestAuthorizeDisabled(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	service := &Service{port: 5202, config: &configuration.Configuration{DisableAuth: true}, logger: logger}
+	if err := service.loadCredentials(); err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	authRouter(service).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/actions/restart/", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("request without authentication = %d, want %d", recorder.Code, http.StatusOK)
+	}
+}
+
+func TestLoadCredentials(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	tests := []struct {
+		name      string
+		port      int
+		config    configuration.Configuration
+		fails     bool
+		anonymous bool
+	}{
+		{"no tokens on all interfaces", 5202, configuration.Configuration{}, true, false},
+		{"no tokens on a public address", 5202, configuration.Configuration{ListenAddress: "192.0.2.1"}, true, false},
+		{"no tokens on loopback", 5202, configuration.Configuration{ListenAddress: "127.0.0.1"}, false, true},
+		{"no tokens on localhost", 5202, configuration.Configuration{ListenAddress: "localhost"}, false, true},
+		{"no tokens on a unix socket", 0, configuration.Configuration{ListenSocket: "/run/exorsus.sock"}, false, true},
+		{"missing token file", 5202, configuration.Configuration{ListenAddress: "127.0.0.1", TokenFile: "/nonexistent/tokens.json"}, true, false},
+		{"disabled", 5202, configuration.Configuration{DisableAuth: true}, false, true},
+		{"tokens", 5202, configuration.Configuration{Tokens: []configuration.Token{{Name: "root", Hash: configuration.HashToken("admin-token")}}}, false, false},
+	}
+	for _, test := range tests {
+		service := &Service{port: test.port, config: &test.config, logger: logger}
+		err := service.loadCredentials()
+		if (err != nil) != test.fails || service.anonymous != test.anonymous {
+			t.Errorf("%s: error %v, anonymous %v; want failure %v, anonymous %v", test.name, err, service.anonymous, test.fails, test.anonymous)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/vvhq/exorsus/events"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const eventsKeepAlive time.Duration = 15 * time.Second
+
+// streamEvents sends process and configuration events as server-sent events.
+// Clients reconnecting with Last-Event-ID (or ?since=) get the buffered
+// events they missed first; new clients only get new events.
+func (service *Service) streamEvents(responseWriter http.ResponseWriter, request *http.Request) {
+	flusher, ok := responseWriter.(http.Flusher)
+	if !ok {
+		service.httpError(responseWriter, request, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	parameters := request.URL.Query()
+	filter := events.Filter{}
+	if apps := parameters.Get("apps"); apps != "" {
+		filter.Applications = strings.Split(apps, ",")
+	}
+	if types := parameters.Get("types"); types != "" {
+		filter.Types = strings.Split(types, ",")
+	}
+	since := parameters.Get("since")
+	if lastEventId := request.Header.Get("Last-Event-ID"); lastEventId != "" {
+		since = lastEventId
+	}
+	var sinceId uint64
+	if since != "" {
+		var err error
+		sinceId, err = strconv.ParseUint(since, 10, 64)
+		if err != nil {
+			service.httpError(responseWriter, request, http.StatusBadRequest, "invalid event id")
+			return
+		}
+	}
+	subscription, replayed := service.bus.Subscribe(filter, sinceId)
+	defer service.bus.Unsubscribe(subscription)
+	if since == "" {
+		replayed = nil
+	}
+
+	responseWriter.Header().Set("Content-Type", "text/event-stream")
+	responseWriter.Header().Set("Cache-Control", "no-cache")
+	responseWriter.Header().Set("X-Accel-Buffering", "no")
+	responseWriter.WriteHeader(http.StatusOK)
+	for _, event := range replayed {
+		if service.allowed(request, event.Application) && !service.writeEvent(responseWriter, event) {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event := <-subscription.C:
+			if !service.allowed(request, event.Application) {
+				continue
+			}
+			if !service.writeEvent(responseWriter, event) {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(responseWriter, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-request.Context().Done():
+			return
+		case <-service.closing:
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func (service *Service) writeEvent(responseWriter http.ResponseWriter, event events.Event) bool {
+	data, err := json.Marshal(event)
+	if err != nil {
+		service.logger.
+			WithField("source", "rest").
+			WithField("error", err.Error()).
+			Error("Can not encode event")
+		return true
+	}
+	_, err = fmt.Fprintf(responseWriter, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err == nil
+}
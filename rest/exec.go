@@ -0,0 +1,95 @@
+package rest
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExecRequest is a command to run in the context of an application.
+// Arguments are split on whitespace like the arguments of an application,
+// and Timeout is a duration such as "30s".
+type ExecRequest struct {
+	Command   string `json:"command"`
+	Arguments string `json:"arguments"`
+	Timeout   string `json:"timeout"`
+}
+
+type ExecResponse struct {
+	Name      string `json:"name"`
+	Code      int    `json:"code"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	TimedOut  bool   `json:"timed_out"`
+	Truncated bool   `json:"truncated"`
+	Duration  int64  `json:"duration_ms"`
+}
+
+// execCommand runs a short-lived command as the user and group, in the
+// working directory and with the environment of the application, and
+// answers with its exit code and output. The timeout defaults to and is
+// capped at ExecTimeout of the configuration. Exec is refused unless it is
+// enabled by EnableExec and REST authentication is on.
+func (service *Service) execCommand(responseWriter http.ResponseWriter, request *http.Request) {
+	if !service.config.EnableExec {
+		service.httpError(responseWriter, request, http.StatusForbidden, "exec disabled by configuration")
+		return
+	}
+	if service.anonymous {
+		service.httpError(responseWriter, request, http.StatusForbidden, "exec requires authentication")
+		return
+	}
+	name := mux.Vars(request)["name"]
+	proc, ok := service.findProcess(name)
+	if !ok {
+		service.httpError(responseWriter, request, http.StatusNotFound, "application not found")
+		return
+	}
+	var execRequest ExecRequest
+	err := json.NewDecoder(request.Body).Decode(&execRequest)
+	if err != nil {
+		service.httpError(responseWriter, request, http.StatusBadRequest, err.Error())
+		return
+	}
+	if record := auditRecord(request); record != nil {
+		record.setParameter("command", execRequest.Command)
+		record.setParameter("arguments", execRequest.Arguments)
+	}
+	if strings.TrimSpace(execRequest.Command) == "" {
+		service.httpError(responseWriter, request, http.StatusBadRequest, "command required")
+		return
+	}
+	timeout := service.config.GetExecTimeout()
+	if execRequest.Timeout != "" {
+		requested, err := time.ParseDuration(execRequest.Timeout)
+		if err != nil {
+			service.httpError(responseWriter, request, http.StatusBadRequest, "invalid timeout")
+			return
+		}
+		if requested > 0 && requested < timeout {
+			timeout = requested
+		}
+	}
+	result, err := proc.Exec(strings.TrimSpace(execRequest.Command), strings.Fields(execRequest.Arguments), timeout)
+	if err != nil {
+		service.httpError(responseWriter, request, http.StatusBadRequest, err.Error())
+		return
+	}
+	if record := auditRecord(request); record != nil {
+		record.setParameter("code", strconv.Itoa(result.Code))
+		if result.TimedOut {
+			record.setParameter("timed_out", "true")
+		}
+	}
+	service.httpJSON(responseWriter, request, http.StatusOK, ExecResponse{
+		Name:      name,
+		Code:      result.Code,
+		Stdout:    result.Stdout,
+		Stderr:    result.Stderr,
+		TimedOut:  result.TimedOut,
+		Truncated: result.Truncated,
+		Duration:  result.Duration.Milliseconds()})
+}
@@ -0,0 +1,36 @@
+package rest
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/vvhq/exorsus/configuration"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExecRefused(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	tests := []struct {
+		name   string
+		config configuration.Configuration
+		error  string
+	}{
+		{"disabled by default", configuration.Configuration{}, "exec disabled by configuration"},
+		{"without authentication", configuration.Configuration{EnableExec: true, DisableAuth: true}, "exec requires authentication"},
+	}
+	for _, test := range tests {
+		service := &Service{config: &test.config, logger: logger}
+		if err := service.loadCredentials(); err != nil {
+			t.Fatal(err)
+		}
+		request := httptest.NewRequest(http.MethodPost, "/applications/web/exec", strings.NewReader(`{"command":"id"}`))
+		recorder := httptest.NewRecorder()
+		service.execCommand(recorder, request)
+		if recorder.Code != http.StatusForbidden || !strings.Contains(recorder.Body.String(), test.error) {
+			t.Errorf("%s: %d %s, want 403 %s", test.name, recorder.Code, recorder.Body.String(), test.error)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package rest
+
+import (
+	"github.com/vvhq/exorsus/process"
+	"net/http"
+	"sort"
+)
+
+const HealthOK string = "ok"
+const HealthFailing string = "failing"
+const ReadinessReady string = "ready"
+const ReadinessNotReady string = "not ready"
+
+// HealthCheck reports whether a part of exorsus is working.
+type HealthCheck func() bool
+
+type Health struct {
+	Status string          `json:"status"`
+	Checks map[string]bool `json:"checks"`
+}
+
+type ApplicationReadiness struct {
+	Name    string `json:"name"`
+	State   string `json:"state"`
+	Healthy bool   `json:"healthy"`
+}
+
+type Readiness struct {
+	Status       string                 `json:"status"`
+	Applications []ApplicationReadiness `json:"applications"`
+}
+
+// AddHealthCheck registers a check reported by /healthz; it must be called
+// before Start.
+func (service *Service) AddHealthCheck(name string, check HealthCheck) {
+	service.healthChecks[name] = check
+}
+
+// healthz answers while the REST service runs, with 503 when a registered
+// check fails.
+func (service *Service) healthz(responseWriter http.ResponseWriter, request *http.Request) {
+	health := Health{Status: HealthOK, Checks: map[string]bool{"rest": true}}
+	for name, check := range service.healthChecks {
+		health.Checks[name] = check()
+		if !health.Checks[name] {
+			health.Status = HealthFailing
+		}
+	}
+	httpStatus := http.StatusOK
+	if health.Status != HealthOK {
+		httpStatus = http.StatusServiceUnavailable
+	}
+	service.httpJSON(responseWriter, request, httpStatus, health)
+}
+
+// readyz reports exorsus ready when every required application is started
+// and healthy. Callers restricted to some applications only see those, but
+// readiness still covers all of them.
+func (service *Service) readyz(responseWriter http.ResponseWriter, request *http.Request) {
+	readiness := Readiness{Status: ReadinessReady, Applications: []ApplicationReadiness{}}
+	for _, proc := range service.proc.List() {
+		if !proc.Required() {
+			continue
+		}
+		healthy := proc.Healthy()
+		if !healthy {
+			readiness.Status = ReadinessNotReady
+		}
+		if service.allowed(request, proc.Name) {
+			readiness.Applications = append(readiness.Applications, ApplicationReadiness{
+				Name:    proc.Name,
+				State:   process.StateName(proc.GetState()),
+				Healthy: healthy})
+		}
+	}
+	sort.Slice(readiness.Applications, func(i, j int) bool {
+		return readiness.Applications[i].Name < readiness.Applications[j].Name
+	})
+	httpStatus := http.StatusOK
+	if readiness.Status != ReadinessReady {
+		httpStatus = http.StatusServiceUnavailable
+	}
+	service.httpJSON(responseWriter, request, httpStatus, readiness)
+}
@@ -0,0 +1,82 @@
+package rest
+
+import (
+	"bufio"
+	"errors"
+	"github.com/vvhq/exorsus/metrics"
+	"github.com/vvhq/exorsus/process"
+	"net"
+	"net/http"
+	"time"
+)
+
+// statusRecorder remembers the status code written by a handler. It keeps
+// the Flusher and Hijacker of the underlying writer for streaming routes.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (recorder *statusRecorder) WriteHeader(code int) {
+	if recorder.code == 0 {
+		recorder.code = code
+	}
+	recorder.ResponseWriter.WriteHeader(code)
+}
+
+func (recorder *statusRecorder) Write(data []byte) (int, error) {
+	if recorder.code == 0 {
+		recorder.code = http.StatusOK
+	}
+	return recorder.ResponseWriter.Write(data)
+}
+
+func (recorder *statusRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (recorder *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := recorder.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err == nil && recorder.code == 0 {
+		recorder.code = http.StatusSwitchingProtocols
+	}
+	return conn, buffered, err
+}
+
+// instrument observes the latency of every matched route by its template.
+func (service *Service) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		started := time.Now()
+		recorder := &statusRecorder{ResponseWriter: responseWriter}
+		next.ServeHTTP(recorder, request)
+		if recorder.code == 0 {
+			recorder.code = http.StatusOK
+		}
+		service.requests.Observe(routeTemplate(request), request.Method, recorder.code, time.Since(started))
+	})
+}
+
+func (service *Service) metrics(responseWriter http.ResponseWriter, request *http.Request) {
+	var applications []process.Metrics
+	for _, procMetrics := range service.proc.MetricsAll() {
+		if service.allowed(request, procMetrics.Name) {
+			applications = append(applications, procMetrics)
+		}
+	}
+	responseWriter.Header().Set("Content-Type", metrics.ContentType)
+	responseWriter.WriteHeader(http.StatusOK)
+	err := metrics.Write(responseWriter, applications, service.requests, service.forwarder.Status(), service.webhooks.Status())
+	if err != nil {
+		service.logger.
+			WithField("source", "rest").
+			WithField("error", err.Error()).
+			WithField("request", request.RequestURI).
+			Error("Request error")
+	}
+}
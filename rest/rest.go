@@ -3,20 +3,41 @@ package rest
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"github.com/vvhq/exorsus/application"
 	"github.com/vvhq/exorsus/configuration"
+	"github.com/vvhq/exorsus/events"
+	"github.com/vvhq/exorsus/forwarding"
+	"github.com/vvhq/exorsus/logging"
+	"github.com/vvhq/exorsus/metrics"
 	"github.com/vvhq/exorsus/process"
 	"github.com/vvhq/exorsus/status"
 	"github.com/vvhq/exorsus/version"
+	"github.com/vvhq/exorsus/webhooks"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
+const maxSearchExpressionLength int = 1024
+
+const apiPrefix string = "/v1"
+
+const defaultWaitTimeout time.Duration = 30 * time.Second
+const maxWaitTimeout time.Duration = 10 * time.Minute
+
 type Service struct {
 	port          int
 	store         *application.Storage
@@ -24,55 +45,206 @@ type Service struct {
 	server        *http.Server
 	mainWaitGroup *sync.WaitGroup
 	config        *configuration.Configuration
+	forwarder     *forwarding.Forwarder
+	webhooks      *webhooks.Dispatcher
+	credentials   []credential
+	anonymous     bool
+	certificates  *certificates
+	operations    *process.Operations
+	bus           *events.Bus
+	requests      *metrics.Requests
+	healthChecks  map[string]HealthCheck
+	auditLog      *logging.AuditLog
+	socketPath    string
+	closing       chan struct{}
 	logger        *logrus.Logger
 }
 
-func (service *Service) Start() {
+// Start loads the credentials and certificates and starts listening; an
+// error means REST could not start and exorsus should not run.
+func (service *Service) Start() error {
+	if err := service.loadCredentials(); err != nil {
+		return err
+	}
 	router := mux.NewRouter()
+	router.Use(service.instrument, service.audit, service.authenticate, service.authorize)
+	service.routes(router)
+	service.routes(router.PathPrefix(apiPrefix).Subrouter())
+	for _, action := range []string{process.ActionStart, process.ActionStop, process.ActionRestart} {
+		router.HandleFunc(apiPrefix+"/actions/"+action+"/", service.actionAll(action)).Methods("POST")
+		router.HandleFunc(apiPrefix+"/actions/"+action+"/{name}", service.action(action)).Methods("POST")
+	}
+	router.HandleFunc(apiPrefix+"/actions/signal/{name}/{signal}", service.signal).Methods("POST")
+	router.HandleFunc("/actions/start/", service.deprecated(service.startAll)).Methods("GET")
+	router.HandleFunc("/actions/stop/", service.deprecated(service.stopAll)).Methods("GET")
+	router.HandleFunc("/actions/restart/", service.deprecated(service.restartAll)).Methods("GET")
+	router.HandleFunc("/actions/start/{name}", service.deprecated(service.startApplication)).Methods("GET")
+	router.HandleFunc("/actions/stop/{name}", service.deprecated(service.stopApplication)).Methods("GET")
+	router.HandleFunc("/actions/restart/{name}", service.deprecated(service.restartApplication)).Methods("GET")
+
+	service.server = &http.Server{Handler: router, ConnContext: socketContext}
+	service.server.RegisterOnShutdown(func() {
+		close(service.closing)
+	})
+	if service.config.TLSEnabled() {
+		service.certificates = &certificates{}
+		err := service.certificates.load(service.config)
+		if err != nil {
+			return fmt.Errorf("can not load TLS certificates: %s", err.Error())
+		}
+		service.server.TLSConfig = service.certificates.tlsConfig(service.config.GetTLSClientAuth())
+	}
+	service.logger.
+		WithField("source", "rest").
+		Trace("Starting REST")
+	if service.port > 0 {
+		address := net.JoinHostPort(service.config.ListenAddress, strconv.Itoa(service.port))
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return err
+		}
+		service.serve(listener, service.certificates != nil)
+	}
+	if service.config.ListenSocket != "" {
+		listener, err := service.listenSocket(service.config.ListenSocket)
+		if err != nil {
+			return err
+		}
+		service.socketPath = service.config.ListenSocket
+		service.serve(listener, false)
+	}
+	service.logger.
+		WithField("source", "rest").
+		Info("REST started")
+	return nil
+}
+
+// routes registers the endpoints shared by the legacy root and the versioned API.
+func (service *Service) routes(router *mux.Router) {
 	router.HandleFunc("/applications/", service.listApplications).Methods("GET")
 	router.HandleFunc("/applications/{name}", service.getApplication).Methods("GET")
 	router.HandleFunc("/applications/", service.createApplication).Methods("POST")
 	router.HandleFunc("/applications/{name}", service.updateApplication).Methods("PUT")
 	router.HandleFunc("/applications/{name}", service.deleteApplication).Methods("DELETE")
-	router.HandleFunc("/actions/start/", service.startAll).Methods("GET")
-	router.HandleFunc("/actions/stop/", service.stopAll).Methods("GET")
-	router.HandleFunc("/actions/restart/", service.restartAll).Methods("GET")
-	router.HandleFunc("/actions/start/{name}", service.startApplication).Methods("GET")
-	router.HandleFunc("/actions/stop/{name}", service.stopApplication).Methods("GET")
-	router.HandleFunc("/actions/restart/{name}", service.restartApplication).Methods("GET")
+	router.HandleFunc("/applications/{name}/exec", service.execCommand).Methods("POST")
 	router.HandleFunc("/status/", service.statusAll).Methods("GET")
 	router.HandleFunc("/status/{name}", service.status).Methods("GET")
+	router.HandleFunc("/logs/search", service.searchLogs).Methods("GET")
+	router.HandleFunc("/logs/{name}", service.logs).Methods("GET")
+	router.HandleFunc("/events", service.streamEvents).Methods("GET")
+	router.HandleFunc("/metrics", service.metrics).Methods("GET")
+	router.HandleFunc("/stdin/{name}", service.writeStdin).Methods("POST", "GET")
+	router.HandleFunc("/attach/{name}", service.attach).Methods("GET")
+	router.HandleFunc("/healthz", service.healthz).Methods("GET")
+	router.HandleFunc("/readyz", service.readyz).Methods("GET")
+	router.HandleFunc("/operations/", service.listOperations).Methods("GET")
+	router.HandleFunc("/operations/{id}", service.getOperation).Methods("GET")
 	router.HandleFunc("/version/", service.getVersion).Methods("GET")
+}
 
-	service.server = &http.Server{Addr: fmt.Sprintf(":%d", service.port), Handler: router}
-	service.logger.
-		WithField("source", "rest").
-		Trace("Starting REST")
+// deprecated marks the GET action endpoints, or rejects them when they are disabled.
+func (service *Service) deprecated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		successor := apiPrefix + request.URL.Path
+		if service.config.DisableGetActions {
+			service.httpError(responseWriter, request, http.StatusGone, fmt.Sprintf("use POST %s", successor))
+			return
+		}
+		responseWriter.Header().Set("Deprecation", "true")
+		responseWriter.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+		handler(responseWriter, request)
+	}
+}
+
+func (service *Service) serve(listener net.Listener, secure bool) {
 	service.mainWaitGroup.Add(1)
 	go func() {
-		err := service.server.ListenAndServe()
-		if err != nil && err.Error() != "http: Server closed" {
+		var err error
+		if secure {
+			err = service.server.ServeTLS(listener, "", "")
+		} else {
+			err = service.server.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			service.logger.
 				WithField("source", "rest").
+				WithField("address", listener.Addr().String()).
 				WithField("error", err.Error()).
 				Error("Can not start REST")
 			os.Exit(1)
 		}
 		service.logger.
 			WithField("source", "rest").
+			WithField("address", listener.Addr().String()).
 			Info("REST stopped")
 		service.mainWaitGroup.Done()
 	}()
-	service.logger.
-		WithField("source", "rest").
-		Info("REST started")
+}
+
+// listenSocket creates the unix socket, replacing a stale one left by a
+// previous run, and applies the configured mode and owner. The socket is
+// created in a private directory and moved into place once both are set,
+// so it is never reachable with the permissions of the umask.
+func (service *Service) listenSocket(socketPath string) (net.Listener, error) {
+	if info, err := os.Lstat(socketPath); err == nil && info.Mode()&os.ModeSocket != 0 {
+		err = os.Remove(socketPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	privateDir, err := ioutil.TempDir(filepath.Dir(socketPath), ".exorsus-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(privateDir)
+	privatePath := filepath.Join(privateDir, filepath.Base(socketPath))
+	listener, err := net.Listen("unix", privatePath)
+	if err != nil {
+		return nil, err
+	}
+	// The socket is removed by Stop, under its final name.
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	err = os.Chmod(privatePath, service.config.GetListenSocketMode())
+	if err == nil && (service.config.ListenSocketUser != "" || service.config.ListenSocketGroup != "") {
+		uid, gid := -1, -1
+		if service.config.ListenSocketUser != "" {
+			uid, err = lookupId(user.Lookup(service.config.ListenSocketUser))
+		}
+		if err == nil && service.config.ListenSocketGroup != "" {
+			lookupGroup, lookupErr := user.LookupGroup(service.config.ListenSocketGroup)
+			if lookupErr != nil {
+				err = lookupErr
+			} else {
+				gid, err = strconv.Atoi(lookupGroup.Gid)
+			}
+		}
+		if err == nil {
+			err = os.Chown(privatePath, uid, gid)
+		}
+	}
+	if err == nil {
+		err = os.Rename(privatePath, socketPath)
+	}
+	if err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+func lookupId(lookupUser *user.User, err error) (int, error) {
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(lookupUser.Uid)
 }
 
 func (service *Service) Stop() {
 	service.logger.
 		WithField("source", "rest").
 		Trace("Stopping REST")
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 	err := service.server.Shutdown(ctx)
 	if err != nil {
 		service.logger.
@@ -80,9 +252,22 @@ func (service *Service) Stop() {
 			WithField("error", err.Error()).
 			Error("REST shutdown error")
 	}
+	if service.socketPath != "" {
+		err = os.Remove(service.socketPath)
+		if err != nil && !os.IsNotExist(err) {
+			service.logger.
+				WithField("source", "rest").
+				WithField("path", service.socketPath).
+				WithField("error", err.Error()).
+				Error("Can not remove REST socket")
+		}
+	}
 }
 
 func (service *Service) httpError(responseWriter http.ResponseWriter, request *http.Request, httpStatus int, errorText string) {
+	if record := auditRecord(request); record != nil {
+		record.Error = errorText
+	}
 	responseWriter.Header().Set("Content-Type", "application/json")
 	jsonError := []byte(fmt.Sprintf("{\"error\":\"%s\"}", errorText))
 	responseWriter.WriteHeader(httpStatus)
@@ -120,6 +305,221 @@ func (service *Service) httpSuccess(responseWriter http.ResponseWriter, request
 	}
 }
 
+func (service *Service) timeFormat(mode string) status.TimeFormat {
+	return status.TimeFormat{
+		Mode:   mode,
+		Layout: service.config.GetDateLayout(),
+		Prefix: service.config.DatePrefix,
+		Suffix: service.config.DateSuffix}
+}
+
+// requestTimeFormat picks the time format from the "time" query parameter:
+// "rfc3339", "epoch" or the configured layout by default.
+func (service *Service) requestTimeFormat(request *http.Request) (status.TimeFormat, bool) {
+	mode := request.URL.Query().Get("time")
+	switch mode {
+	case "", status.TimeLayout:
+		return service.timeFormat(status.TimeLayout), true
+	case status.TimeRFC3339, status.TimeEpoch:
+		return service.timeFormat(mode), true
+	default:
+		return status.TimeFormat{}, false
+	}
+}
+
+func (service *Service) httpJSON(responseWriter http.ResponseWriter, request *http.Request, httpStatus int, value interface{}) {
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		service.httpError(responseWriter, request, http.StatusInternalServerError, err.Error())
+		return
+	}
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.WriteHeader(httpStatus)
+	_, err = responseWriter.Write(jsonValue)
+	if err != nil {
+		service.logger.
+			WithField("source", "rest").
+			WithField("error", err.Error()).
+			WithField("request", request.RequestURI).
+			Error("Response error")
+	} else {
+		service.logger.
+			WithField("source", "rest").
+			WithField("request", request.RequestURI).
+			Trace("Response success")
+	}
+}
+
+func (service *Service) findProcess(name string) (*process.Process, bool) {
+	for _, proc := range service.proc.List() {
+		if proc.Name == name {
+			return proc, true
+		}
+	}
+	return nil, false
+}
+
+// waitParameters reads "wait" and "timeout" query parameters of an action;
+// the default timeout only applies when the parameter is absent.
+func waitParameters(request *http.Request) (bool, time.Duration, error) {
+	parameters := request.URL.Query()
+	wait, err := strconv.ParseBool(parameters.Get("wait"))
+	if err != nil && parameters.Get("wait") != "" {
+		return false, 0, err
+	}
+	timeout := defaultWaitTimeout
+	if parameters.Get("timeout") != "" {
+		timeout, err = time.ParseDuration(parameters.Get("timeout"))
+		if err != nil {
+			return false, 0, err
+		}
+		if timeout <= 0 {
+			return false, 0, errors.New("timeout must be positive")
+		}
+		if timeout > maxWaitTimeout {
+			timeout = maxWaitTimeout
+		}
+	}
+	return wait, timeout, nil
+}
+
+// runOperation starts the action as an operation and answers with it: 202
+// when accepted and 409 when no process accepted it. With wait=true it
+// blocks until the operation has finished and returns the final status.
+func (service *Service) runOperation(responseWriter http.ResponseWriter, request *http.Request, action string, processes []*process.Process) {
+	wait, timeout, err := waitParameters(request)
+	if err != nil {
+		service.httpError(responseWriter, request, http.StatusBadRequest, "invalid wait parameters")
+		return
+	}
+	operation := service.operations.Run(action, processes)
+	if record := auditRecord(request); record != nil {
+		record.Operation = operation.ID
+	}
+	responseWriter.Header().Set("Location", apiPrefix+"/operations/"+operation.ID)
+	snapshot := operation.Snapshot()
+	if snapshot.Status == process.OperationFailed {
+		service.httpJSON(responseWriter, request, http.StatusConflict, snapshot)
+		return
+	}
+	if !wait {
+		service.httpJSON(responseWriter, request, http.StatusAccepted, snapshot)
+		return
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	httpStatus := http.StatusOK
+	select {
+	case <-operation.Done():
+	case <-timer.C:
+		httpStatus = http.StatusGatewayTimeout
+	case <-request.Context().Done():
+		return
+	}
+	allStatus := make([]process.Status, 0, len(processes))
+	for idx, progress := range operation.Snapshot().Applications {
+		procStatus := http.StatusOK
+		switch progress.Status {
+		case process.OperationRunning, process.OperationTimeout:
+			procStatus = http.StatusGatewayTimeout
+		case process.OperationFailed:
+			procStatus = http.StatusInternalServerError
+		}
+		if procStatus > httpStatus {
+			httpStatus = procStatus
+		}
+		allStatus = append(allStatus, process.NewStatus(processes[idx], service.timeFormat(status.TimeLayout)))
+	}
+	if mux.Vars(request)["name"] != "" {
+		service.httpJSON(responseWriter, request, httpStatus, allStatus[0])
+		return
+	}
+	service.httpJSON(responseWriter, request, httpStatus, allStatus)
+}
+
+func (service *Service) action(action string) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		proc, ok := service.findProcess(mux.Vars(request)["name"])
+		if !ok {
+			service.httpError(responseWriter, request, http.StatusNotFound, "application not found")
+			return
+		}
+		service.runOperation(responseWriter, request, action, []*process.Process{proc})
+	}
+}
+
+// signal sends a signal to the running process of an application; unlike
+// the other actions it takes effect right away and is not an operation.
+func (service *Service) signal(responseWriter http.ResponseWriter, request *http.Request) {
+	urlParameters := mux.Vars(request)
+	signal, err := process.ParseSignal(urlParameters["signal"])
+	if err != nil {
+		service.httpError(responseWriter, request, http.StatusBadRequest, err.Error())
+		return
+	}
+	err = service.proc.Signal(urlParameters["name"], signal)
+	switch err {
+	case nil:
+		service.httpSuccess(responseWriter, request, urlParameters["name"])
+	case process.ErrNotFound:
+		service.httpError(responseWriter, request, http.StatusNotFound, err.Error())
+	case process.ErrNotRunning, process.ErrClosed:
+		service.httpError(responseWriter, request, http.StatusConflict, err.Error())
+	default:
+		service.httpError(responseWriter, request, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (service *Service) actionAll(action string) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		processes := service.proc.List()
+		if len(processes) == 0 {
+			service.httpError(responseWriter, request, http.StatusNotFound, "no applications found")
+			return
+		}
+		sort.Slice(processes, func(i, j int) bool {
+			return processes[i].Name < processes[j].Name
+		})
+		service.runOperation(responseWriter, request, action, processes)
+	}
+}
+
+func (service *Service) listOperations(responseWriter http.ResponseWriter, request *http.Request) {
+	operations := make([]process.OperationStatus, 0)
+	for _, operation := range service.operations.List() {
+		snapshot := operation.Snapshot()
+		if service.allowedOperation(request, snapshot) {
+			operations = append(operations, snapshot)
+		}
+	}
+	service.httpJSON(responseWriter, request, http.StatusOK, operations)
+}
+
+func (service *Service) getOperation(responseWriter http.ResponseWriter, request *http.Request) {
+	operation, ok := service.operations.Get(mux.Vars(request)["id"])
+	if !ok {
+		service.httpError(responseWriter, request, http.StatusNotFound, "operation not found")
+		return
+	}
+	snapshot := operation.Snapshot()
+	if !service.allowedOperation(request, snapshot) {
+		service.httpError(responseWriter, request, http.StatusNotFound, "operation not found")
+		return
+	}
+	service.httpJSON(responseWriter, request, http.StatusOK, snapshot)
+}
+
+// allowedOperation reports whether the caller may see every application of
+// the operation.
+func (service *Service) allowedOperation(request *http.Request, operation process.OperationStatus) bool {
+	for _, progress := range operation.Applications {
+		if !service.allowed(request, progress.Application) {
+			return false
+		}
+	}
+	return true
+}
+
 func (service *Service) getApplication(responseWriter http.ResponseWriter, request *http.Request) {
 	responseWriter.Header().Set("Content-Type", "application/json")
 	urlParameters := mux.Vars(request)
@@ -155,7 +555,12 @@ func (service *Service) getApplication(responseWriter http.ResponseWriter, reque
 
 func (service *Service) listApplications(responseWriter http.ResponseWriter, request *http.Request) {
 	responseWriter.Header().Set("Content-Type", "application/json")
-	applications := service.store.List()
+	var applications []application.Application
+	for _, app := range service.store.List() {
+		if service.allowed(request, app.Name) {
+			applications = append(applications, app)
+		}
+	}
 	jsonApplications, err := json.Marshal(applications)
 	if err != nil {
 		service.httpError(responseWriter, request, http.StatusBadRequest, err.Error())
@@ -188,11 +593,19 @@ func (service *Service) createApplication(responseWriter http.ResponseWriter, re
 		service.httpError(responseWriter, request, http.StatusBadRequest, err.Error())
 		return
 	}
+	if record := auditRecord(request); record != nil {
+		record.Application = app.Name
+		record.Current = &app
+	}
+	if !service.allowed(request, app.Name) {
+		service.httpError(responseWriter, request, http.StatusForbidden, "access denied")
+		return
+	}
 	err = service.store.Add(app)
 	if err != nil {
 		service.httpError(responseWriter, request, 400, err.Error())
 	} else {
-		service.proc.Append(process.New(&app, status.New(100), service.mainWaitGroup, service.config, service.logger))
+		service.proc.Append(process.New(&app, service.mainWaitGroup, service.config, service.forwarder, service.bus, service.logger))
 		service.httpSuccess(responseWriter, request, app.Name)
 	}
 }
@@ -211,12 +624,22 @@ func (service *Service) updateApplication(responseWriter http.ResponseWriter, re
 		service.httpError(responseWriter, request, http.StatusBadRequest, err.Error())
 		return
 	}
+	if record := auditRecord(request); record != nil {
+		if previous, ok := service.store.Get(applicationName); ok {
+			record.Previous = &previous
+		}
+		record.Current = &app
+	}
+	if !service.allowed(request, app.Name) {
+		service.httpError(responseWriter, request, http.StatusForbidden, "access denied")
+		return
+	}
 	err = service.store.Update(applicationName, app)
 	if err != nil {
 		service.httpError(responseWriter, request, 404, err.Error())
 	} else {
-		procStatus, _ := service.proc.Status(applicationName)
-		updatedProc := process.New(&app, status.New(100), service.mainWaitGroup, service.config, service.logger)
+		procStatus, _ := service.proc.Status(applicationName, service.timeFormat(status.TimeLayout))
+		updatedProc := process.New(&app, service.mainWaitGroup, service.config, service.forwarder, service.bus, service.logger)
 		service.proc.Delete(applicationName)
 		service.proc.Append(updatedProc)
 		if procStatus.State == "Started" {
@@ -233,6 +656,11 @@ func (service *Service) deleteApplication(responseWriter http.ResponseWriter, re
 		service.httpError(responseWriter, request, http.StatusBadRequest, "application name required")
 		return
 	}
+	if record := auditRecord(request); record != nil {
+		if previous, ok := service.store.Get(applicationName); ok {
+			record.Previous = &previous
+		}
+	}
 	err := service.store.Delete(applicationName)
 	if err != nil {
 		service.httpError(responseWriter, request, 404, err.Error())
@@ -328,7 +756,17 @@ func (service *Service) restartAll(responseWriter http.ResponseWriter, request *
 
 func (service *Service) statusAll(responseWriter http.ResponseWriter, request *http.Request) {
 	responseWriter.Header().Set("Content-Type", "application/json")
-	allStatus := service.proc.StatusAll()
+	format, ok := service.requestTimeFormat(request)
+	if !ok {
+		service.httpError(responseWriter, request, http.StatusBadRequest, "unknown time format")
+		return
+	}
+	var allStatus []process.Status
+	for _, procStatus := range service.proc.StatusAll(format) {
+		if service.allowed(request, procStatus.Name) {
+			allStatus = append(allStatus, procStatus)
+		}
+	}
 	jsonAllStatus, err := json.Marshal(allStatus)
 	if err != nil {
 		service.httpError(responseWriter, request, http.StatusBadRequest, err.Error())
@@ -366,7 +804,12 @@ func (service *Service) status(responseWriter http.ResponseWriter, request *http
 		service.httpError(responseWriter, request, http.StatusNotFound, "application not found")
 		return
 	}
-	appStatus, ok := service.proc.Status(app.Name)
+	format, ok := service.requestTimeFormat(request)
+	if !ok {
+		service.httpError(responseWriter, request, http.StatusBadRequest, "unknown time format")
+		return
+	}
+	appStatus, ok := service.proc.Status(app.Name, format)
 	if !ok {
 		service.httpError(responseWriter, request, http.StatusNotFound, "application not found")
 		return
@@ -391,6 +834,153 @@ func (service *Service) status(responseWriter http.ResponseWriter, request *http
 	}
 }
 
+func (service *Service) logs(responseWriter http.ResponseWriter, request *http.Request) {
+	responseWriter.Header().Set("Content-Type", "application/json")
+	urlParameters := mux.Vars(request)
+	applicationName, ok := urlParameters["name"]
+	if !ok {
+		service.httpError(responseWriter, request, http.StatusBadRequest, "application name required")
+		return
+	}
+	stream := request.URL.Query().Get("stream")
+	if stream != "" && stream != status.StreamStdOut && stream != status.StreamStdErr {
+		service.httpError(responseWriter, request, http.StatusBadRequest, "unknown stream")
+		return
+	}
+	level := request.URL.Query().Get("level")
+	items, ok := service.proc.Logs(applicationName, stream, level)
+	if !ok {
+		service.httpError(responseWriter, request, http.StatusNotFound, "application not found")
+		return
+	}
+	jsonItems, err := json.Marshal(items)
+	if err != nil {
+		service.httpError(responseWriter, request, http.StatusBadRequest, err.Error())
+		return
+	}
+	_, err = responseWriter.Write(jsonItems)
+	if err != nil {
+		service.logger.
+			WithField("source", "rest").
+			WithField("error", err.Error()).
+			WithField("request", request.RequestURI).
+			Error("Response error")
+	} else {
+		service.logger.
+			WithField("source", "rest").
+			WithField("request", request.RequestURI).
+			Trace("Response success")
+	}
+}
+
+func (service *Service) searchLogs(responseWriter http.ResponseWriter, request *http.Request) {
+	responseWriter.Header().Set("Content-Type", "application/json")
+	parameters := request.URL.Query()
+	expression := parameters.Get("q")
+	if expression == "" {
+		service.httpError(responseWriter, request, http.StatusBadRequest, "search expression required")
+		return
+	}
+	if len(expression) > maxSearchExpressionLength {
+		service.httpError(responseWriter, request, http.StatusBadRequest, "search expression too long")
+		return
+	}
+	pattern, err := regexp.Compile(expression)
+	if err != nil {
+		service.httpError(responseWriter, request, http.StatusBadRequest, "invalid search expression")
+		return
+	}
+	query := process.SearchQuery{
+		Pattern:    pattern,
+		MaxResults: service.config.GetSearchMaxResults(),
+		Timeout:    service.config.GetSearchTimeout(),
+		Disk:       parameters.Get("disk") != "false"}
+	if apps := parameters.Get("apps"); apps != "" {
+		query.Apps = strings.Split(apps, ",")
+	}
+	if identity, ok := RequestIdentity(request); ok && identity.Scoped() {
+		if len(query.Apps) == 0 {
+			for _, proc := range service.proc.List() {
+				query.Apps = append(query.Apps, proc.Name)
+			}
+		}
+		var apps []string
+		for _, name := range query.Apps {
+			if identity.Allows(name) {
+				apps = append(apps, name)
+			}
+		}
+		if len(apps) == 0 {
+			service.httpError(responseWriter, request, http.StatusForbidden, "access denied")
+			return
+		}
+		query.Apps = apps
+	}
+	if since := parameters.Get("since"); since != "" {
+		query.Since, err = parseSince(since)
+		if err != nil {
+			service.httpError(responseWriter, request, http.StatusBadRequest, "invalid since")
+			return
+		}
+	}
+	if context := parameters.Get("context"); context != "" {
+		query.Context, err = strconv.Atoi(context)
+		if err != nil || query.Context < 0 {
+			service.httpError(responseWriter, request, http.StatusBadRequest, "invalid context")
+			return
+		}
+		if query.Context > configuration.DefaultSearchMaxContext {
+			query.Context = configuration.DefaultSearchMaxContext
+		}
+	}
+	if limit := parameters.Get("limit"); limit != "" {
+		maxResults, err := strconv.Atoi(limit)
+		if err != nil || maxResults <= 0 {
+			service.httpError(responseWriter, request, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		if maxResults < query.MaxResults {
+			query.MaxResults = maxResults
+		}
+	}
+	result := service.proc.Search(query)
+	jsonResult, err := json.Marshal(result)
+	if err != nil {
+		service.httpError(responseWriter, request, http.StatusBadRequest, err.Error())
+		return
+	}
+	_, err = responseWriter.Write(jsonResult)
+	if err != nil {
+		service.logger.
+			WithField("source", "rest").
+			WithField("error", err.Error()).
+			WithField("request", request.RequestURI).
+			Error("Response error")
+	} else {
+		service.logger.
+			WithField("source", "rest").
+			WithField("request", request.RequestURI).
+			Trace("Response success")
+	}
+}
+
+// parseSince accepts an RFC3339 time, a unix timestamp or a duration relative to now.
+func parseSince(since string) (time.Time, error) {
+	parsed, err := time.Parse(time.RFC3339Nano, since)
+	if err == nil {
+		return parsed, nil
+	}
+	seconds, err := strconv.ParseInt(since, 10, 64)
+	if err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	duration, err := time.ParseDuration(since)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(-duration), nil
+}
+
 func (service *Service) getVersion(responseWriter http.ResponseWriter, request *http.Request) {
 	jsonVersion := fmt.Sprintf("{\"version\": \"%s\"}", version.Version)
 	responseWriter.Header().Set("Content-Type", "application/json")
@@ -409,6 +999,7 @@ func (service *Service) getVersion(responseWriter http.ResponseWriter, request *
 	}
 }
 
-func New(port int, store *application.Storage, proc *process.Manager, wg *sync.WaitGroup, config *configuration.Configuration, logger *logrus.Logger) *Service {
-	return &Service{port: port, store: store, proc: proc, mainWaitGroup: wg, config: config, logger: logger}
+func New(port int, store *application.Storage, proc *process.Manager, wg *sync.WaitGroup, config *configuration.Configuration, forwarder *forwarding.Forwarder, dispatcher *webhooks.Dispatcher, bus *events.Bus, auditLog *logging.AuditLog, logger *logrus.Logger) *Service {
+	operations := process.NewOperations(config.GetOperationRetention(), config.GetOperationTimeout())
+	return &Service{port: port, store: store, proc: proc, mainWaitGroup: wg, config: config, forwarder: forwarder, webhooks: dispatcher, operations: operations, bus: bus, requests: metrics.NewRequests(metrics.DefaultBuckets), healthChecks: make(map[string]HealthCheck), auditLog: auditLog, closing: make(chan struct{}), logger: logger}
 }
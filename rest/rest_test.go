@@ -0,0 +1,35 @@
+package rest
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWaitParameters(t *testing.T) {
+	tests := []struct {
+		query   string
+		wait    bool
+		timeout time.Duration
+		valid   bool
+	}{
+		{"", false, defaultWaitTimeout, true},
+		{"?wait=true", true, defaultWaitTimeout, true},
+		{"?wait=true&timeout=5s", true, 5 * time.Second, true},
+		{"?wait=true&timeout=1h", true, maxWaitTimeout, true},
+		{"?wait=true&timeout=0s", false, 0, false},
+		{"?wait=true&timeout=-1s", false, 0, false},
+		{"?wait=true&timeout=soon", false, 0, false},
+		{"?wait=maybe", false, 0, false},
+	}
+	for _, test := range tests {
+		wait, timeout, err := waitParameters(httptest.NewRequest("POST", "/v1/actions/start/web"+test.query, nil))
+		if (err == nil) != test.valid {
+			t.Errorf("waitParameters(%q) error = %v, want valid %v", test.query, err, test.valid)
+			continue
+		}
+		if test.valid && (wait != test.wait || timeout != test.timeout) {
+			t.Errorf("waitParameters(%q) = %v, %v, want %v, %v", test.query, wait, timeout, test.wait, test.timeout)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package rest
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"github.com/vvhq/exorsus/configuration"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func socketClient(socketPath string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}}}
+}
+
+func TestListenSocket(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	for _, test := range []struct {
+		name string
+		auth string
+		code int
+	}{
+		{"token", "", http.StatusUnauthorized},
+		{"trusted", configuration.ListenSocketAuthNone, http.StatusOK},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			socketPath := filepath.Join(dir, "exorsus.sock")
+			config := &configuration.Configuration{
+				ListenSocket:     socketPath,
+				ListenSocketMode: "0600",
+				ListenSocketAuth: test.auth,
+				Tokens:           []configuration.Token{{Name: "root", Hash: configuration.HashToken("admin-token")}}}
+			service := &Service{config: config, logger: logger}
+			if err := service.loadCredentials(); err != nil {
+				t.Fatal(err)
+			}
+			listener, err := service.listenSocket(socketPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			service.socketPath = socketPath
+			info, err := os.Stat(socketPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0600 || info.Mode()&os.ModeSocket == 0 {
+				t.Errorf("socket mode = %v, want a socket with 0600", info.Mode())
+			}
+			if entries, _ := ioutil.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("%d entries next to the socket, want the private directory removed", len(entries))
+			}
+
+			service.server = &http.Server{Handler: authRouter(service), ConnContext: socketContext}
+			go func() { _ = service.server.Serve(listener) }()
+			response, err := socketClient(socketPath).Post("http://exorsus/applications/", "application/json", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = response.Body.Close()
+			if response.StatusCode != test.code {
+				t.Errorf("admin request over the socket = %d, want %d", response.StatusCode, test.code)
+			}
+
+			service.Stop()
+			if _, err := os.Lstat(socketPath); !os.IsNotExist(err) {
+				t.Errorf("socket left after Stop: %v", err)
+			}
+		})
+	}
+}
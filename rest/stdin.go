@@ -0,0 +1,134 @@
+package rest
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/vvhq/exorsus/process"
+	"github.com/vvhq/exorsus/websocket"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+const stdinChunkSize int = 32 * 1024
+
+type StdinResult struct {
+	Name   string `json:"name"`
+	Bytes  int64  `json:"bytes"`
+	Closed bool   `json:"closed"`
+}
+
+// stdinStatus maps errors of writing to stdin to HTTP status codes.
+func stdinStatus(err error) int {
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case err == process.ErrStdinDisabled, err == process.ErrStdinClosed, err == process.ErrNotRunning:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// writeStdin copies the request body to the stdin of the process; with
+// close=true stdin is closed afterwards. A GET with a websocket handshake
+// writes every message instead.
+func (service *Service) writeStdin(responseWriter http.ResponseWriter, request *http.Request) {
+	name := mux.Vars(request)["name"]
+	proc, ok := service.findProcess(name)
+	if !ok {
+		service.httpError(responseWriter, request, http.StatusNotFound, "application not found")
+		return
+	}
+	closeStdin := false
+	if value := request.URL.Query().Get("close"); value != "" {
+		var err error
+		closeStdin, err = strconv.ParseBool(value)
+		if err != nil {
+			service.httpError(responseWriter, request, http.StatusBadRequest, "invalid close parameter")
+			return
+		}
+	}
+	if request.Method == http.MethodGet {
+		service.streamStdin(responseWriter, request, proc, closeStdin)
+		return
+	}
+	var written int64
+	buffer := make([]byte, stdinChunkSize)
+	for {
+		read, err := request.Body.Read(buffer)
+		if read > 0 {
+			count, writeErr := proc.WriteStdin(buffer[:read])
+			written += int64(count)
+			if writeErr != nil {
+				service.auditBytes(request, written)
+				service.httpError(responseWriter, request, stdinStatus(writeErr), writeErr.Error())
+				return
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			service.auditBytes(request, written)
+			service.httpError(responseWriter, request, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	service.auditBytes(request, written)
+	if closeStdin {
+		if err := proc.CloseStdin(); err != nil {
+			service.httpError(responseWriter, request, stdinStatus(err), err.Error())
+			return
+		}
+	}
+	service.httpJSON(responseWriter, request, http.StatusOK, StdinResult{Name: name, Bytes: written, Closed: closeStdin})
+}
+
+// streamStdin writes every websocket message to stdin until the client or
+// the process goes away.
+func (service *Service) streamStdin(responseWriter http.ResponseWriter, request *http.Request, proc *process.Process, closeStdin bool) {
+	// Refuse before the upgrade, so the client gets a proper status.
+	if err := proc.CheckStdin(); err != nil {
+		service.httpError(responseWriter, request, stdinStatus(err), err.Error())
+		return
+	}
+	conn, err := websocket.Upgrade(responseWriter, request, service.config.WebSocketOrigins)
+	if err != nil {
+		return
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-service.closing:
+			_ = conn.CloseWithReason(websocket.CloseGoingAway, "exorsus stopping")
+		case <-done:
+		}
+	}()
+	var written int64
+	defer func() {
+		service.auditBytes(request, written)
+	}()
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if err == websocket.ErrClosed && closeStdin {
+				_ = proc.CloseStdin()
+			}
+			return
+		}
+		count, err := proc.WriteStdin(message)
+		written += int64(count)
+		if err != nil {
+			_ = conn.CloseWithReason(websocket.CloseInternalError, err.Error())
+			return
+		}
+	}
+}
+
+func (service *Service) auditBytes(request *http.Request, written int64) {
+	if record := auditRecord(request); record != nil {
+		record.setParameter("bytes", strconv.FormatInt(written, 10))
+	}
+}
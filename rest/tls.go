@@ -0,0 +1,100 @@
+package rest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/vvhq/exorsus/configuration"
+	"io/ioutil"
+	"sync"
+)
+
+// certificates holds the server certificate and client CA pool, which are
+// swapped on reload while the listener keeps running.
+type certificates struct {
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+	lock        sync.RWMutex
+}
+
+// load fails when client certificates are verified without a CA bundle,
+// since they would be checked against the system roots.
+func (certs *certificates) load(config *configuration.Configuration) error {
+	if config.GetTLSClientAuth() != configuration.TLSClientAuthNone && config.TLSClientCAFile == "" {
+		return errors.New("client certificate verification requires TLSClientCAFile")
+	}
+	certificate, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+	if err != nil {
+		return err
+	}
+	var clientCAs *x509.CertPool
+	if config.TLSClientCAFile != "" {
+		pem, err := ioutil.ReadFile(config.TLSClientCAFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in client CA file")
+		}
+	}
+	certs.lock.Lock()
+	defer certs.lock.Unlock()
+	certs.certificate = &certificate
+	certs.clientCAs = clientCAs
+	return nil
+}
+
+func (certs *certificates) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certs.lock.RLock()
+	defer certs.lock.RUnlock()
+	return certs.certificate, nil
+}
+
+func (certs *certificates) tlsConfig(clientAuth string) *tls.Config {
+	base := &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.getCertificate}
+	switch clientAuth {
+	case configuration.TLSClientAuthRequire:
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	case configuration.TLSClientAuthRequest:
+		base.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return base
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		certs.lock.RLock()
+		defer certs.lock.RUnlock()
+		config := base.Clone()
+		config.GetConfigForClient = nil
+		config.ClientCAs = certs.clientCAs
+		return config, nil
+	}
+	return base
+}
+
+// ReloadTLS reloads the certificate, key and client CA bundle from disk;
+// on error the previous ones stay in use.
+func (service *Service) ReloadTLS() {
+	if service.certificates == nil {
+		return
+	}
+	err := service.certificates.load(service.config)
+	if err != nil {
+		service.logger.
+			WithField("source", "rest").
+			WithField("error", err.Error()).
+			Error("Can not reload TLS certificates")
+		return
+	}
+	service.logger.
+		WithField("source", "rest").
+		Info("TLS certificates reloaded")
+}
+
+// clientCommonName returns the CN of a verified client certificate.
+func clientCommonName(state *tls.ConnectionState) (string, bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	return state.VerifiedChains[0][0].Subject.CommonName, true
+}
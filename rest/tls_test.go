@@ -0,0 +1,16 @@
+package rest
+
+import (
+	"github.com/vvhq/exorsus/configuration"
+	"testing"
+)
+
+func TestCertificatesRequireClientCA(t *testing.T) {
+	for _, clientAuth := range []string{configuration.TLSClientAuthRequest, configuration.TLSClientAuthRequire} {
+		config := &configuration.Configuration{TLSCertFile: "cert.pem", TLSKeyFile: "key.pem", TLSClientAuth: clientAuth}
+		err := (&certificates{}).load(config)
+		if err == nil || err.Error() != "client certificate verification requires TLSClientCAFile" {
+			t.Errorf("load with client auth %s and no CA = %v", clientAuth, err)
+		}
+	}
+}
@@ -9,10 +9,19 @@ import (
 	"github.com/vvhq/exorsus/rest"
 	"os"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
+var handling int32
+
+// Running reports whether HandleSignals is waiting for signals; it is false
+// before it starts and once a stop signal was received.
+func Running() bool {
+	return atomic.LoadInt32(&handling) == 1
+}
+
 func HandleSignals(wg *sync.WaitGroup,
 	signalChan chan os.Signal,
 	procManager *process.Manager,
@@ -20,7 +29,9 @@ func HandleSignals(wg *sync.WaitGroup,
 	timeout int,
 	config *configuration.Configuration,
 	logger *logrus.Logger,
-	loggerHook *logging.FileHook) {
+	loggerHook *logging.FileHook,
+	auditLog *logging.AuditLog) {
+	atomic.StoreInt32(&handling, 1)
 	for {
 		receivedSignal := <-signalChan
 		logger.
@@ -28,10 +39,11 @@ func HandleSignals(wg *sync.WaitGroup,
 			WithField("signal", receivedSignal.String()).
 			Info("Signal received")
 		if receivedSignal == syscall.SIGUSR1 {
-			handleUSR1(logger, loggerHook)
+			handleUSR1(logger, loggerHook, auditLog)
 		} else if receivedSignal == syscall.SIGHUP {
-			handleHUP(logger)
+			handleHUP(restService, logger)
 		} else if receivedSignal == syscall.SIGINT || receivedSignal == syscall.SIGTERM {
+			atomic.StoreInt32(&handling, 0)
 			handleSTOP(procManager, restService, timeout, logger)
 			wg.Done()
 			return
@@ -44,18 +56,26 @@ func HandleSignals(wg *sync.WaitGroup,
 	}
 }
 
-func handleUSR1(logger *logrus.Logger, loggerHook *logging.FileHook) {
+func handleUSR1(logger *logrus.Logger, loggerHook *logging.FileHook, auditLog *logging.AuditLog) {
 	loggerHook.Rotate()
+	err := auditLog.Rotate()
+	if err != nil {
+		logger.
+			WithField("source", "signals").
+			WithField("error", err.Error()).
+			Error("Can not rotate audit log")
+	}
 	logger.
 		WithField("source", "signals").
 		Info("Log rotated")
 }
 
-func handleHUP(logger *logrus.Logger) {
+func handleHUP(restService *rest.Service, logger *logrus.Logger) {
 	logger.
 		WithField("source", "signals").
 		WithField("signal", "HUP").
 		Info("Signal received")
+	restService.ReloadTLS()
 }
 
 func handleSTOP(procManager *process.Manager, restService *rest.Service, timeout int, logger *logrus.Logger) {
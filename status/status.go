@@ -2,54 +2,212 @@ package status
 
 import (
 	"fmt"
-	"github.com/vvhq/exorsus/configuration"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
+const StreamStdOut string = "stdout"
+const StreamStdErr string = "stderr"
+
+const LevelTrace string = "trace"
+const LevelDebug string = "debug"
+const LevelInfo string = "info"
+const LevelWarn string = "warn"
+const LevelError string = "error"
+const LevelFatal string = "fatal"
+
+var levels = []string{LevelTrace, LevelDebug, LevelInfo, LevelWarn, LevelError, LevelFatal}
+
+// LevelRank orders levels by severity; unknown levels rank as info.
+func LevelRank(level string) int {
+	for rank, name := range levels {
+		if name == level {
+			return rank
+		}
+	}
+	return 2
+}
+
+// Item is a single captured line of output. For structured formats
+// Level, Message, Fields and Time are taken from the line itself.
+type Item struct {
+	Time    time.Time              `json:"time"`
+	Stream  string                 `json:"stream"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+	Line    string                 `json:"-"`
+}
+
+const TimeLayout string = "layout"
+const TimeRFC3339 string = "rfc3339"
+const TimeEpoch string = "epoch"
+
+// TimeFormat renders captured items as "<prefix><time><suffix> <line>".
+type TimeFormat struct {
+	Mode   string
+	Layout string
+	Prefix string
+	Suffix string
+}
+
+func (format TimeFormat) Render(item Item) string {
+	var timestamp string
+	switch format.Mode {
+	case TimeRFC3339:
+		timestamp = item.Time.Format(time.RFC3339Nano)
+	case TimeEpoch:
+		timestamp = strconv.FormatFloat(float64(item.Time.UnixNano())/float64(time.Second), 'f', 3, 64)
+	default:
+		timestamp = item.Time.Format(format.Layout)
+	}
+	return fmt.Sprintf("%s%s%s %s", format.Prefix, timestamp, format.Suffix, item.Line)
+}
+
+const minRingSize int = 16
+
+// IOStdStore is a ring buffer of captured items bounded by both line count
+// and total bytes of raw lines. Evicted items are counted as dropped.
 type IOStdStore struct {
-	max       int
-	warehouse []string
-	lock      sync.RWMutex
+	max          int
+	maxBytes     int
+	bytes        int
+	head         int
+	count        int
+	ring         []Item
+	lines        uint64
+	droppedLines uint64
+	droppedBytes uint64
+	lock         sync.RWMutex
 }
 
-func (store *IOStdStore) Append(item string) {
-	item = fmt.Sprintf("%s%s%s %s",
-		configuration.DefaultStdDatePrefix,
-		time.Now().Format(configuration.DefaultStdDateLayout),
-		configuration.DefaultStdDateSuffix,
-		item)
+func (store *IOStdStore) Append(item Item) {
 	store.lock.Lock()
 	defer store.lock.Unlock()
-	store.warehouse = append(store.warehouse, item)
-	if len(store.warehouse) > store.max {
-		shifted := make([]string, store.max)
-		idx := len(store.warehouse) - store.max
-		copy(shifted, store.warehouse[idx:])
-		store.warehouse = shifted
+	if len(item.Line) > store.maxBytes {
+		line := truncate(item.Line, store.maxBytes)
+		store.droppedBytes += uint64(len(item.Line) - len(line))
+		if item.Message == item.Line {
+			item.Message = line
+		} else if len(item.Message) > store.maxBytes {
+			item.Message = truncate(item.Message, store.maxBytes)
+		}
+		item.Line = line
+	}
+	for store.count > 0 && (store.count >= store.max || store.bytes+len(item.Line) > store.maxBytes) {
+		store.evict()
 	}
+	if store.count == len(store.ring) {
+		store.grow()
+	}
+	store.ring[(store.head+store.count)%len(store.ring)] = item
+	store.count++
+	store.lines++
+	store.bytes += len(item.Line)
+}
+
+func (store *IOStdStore) evict() {
+	oldest := &store.ring[store.head]
+	store.bytes -= len(oldest.Line)
+	store.droppedLines++
+	store.droppedBytes += uint64(len(oldest.Line))
+	*oldest = Item{}
+	store.head = (store.head + 1) % len(store.ring)
+	store.count--
 }
 
-func (store *IOStdStore) List() []string {
+// truncate cuts the value to at most max bytes on a rune boundary and copies
+// it, so the long original can be collected.
+func truncate(value string, max int) string {
+	end := max
+	for end > 0 && !utf8.RuneStart(value[end]) {
+		end--
+	}
+	return string([]byte(value[:end]))
+}
+
+// grow doubles the ring up to max, so small buffers stay small while the
+// amortized cost of Append remains O(1).
+func (store *IOStdStore) grow() {
+	size := len(store.ring) * 2
+	if size < minRingSize {
+		size = minRingSize
+	}
+	if size > store.max {
+		size = store.max
+	}
+	ring := make([]Item, size)
+	store.copyTo(ring)
+	store.ring = ring
+	store.head = 0
+}
+
+func (store *IOStdStore) copyTo(buffer []Item) int {
+	if store.count == 0 {
+		return 0
+	}
+	count := store.count
+	if count > len(buffer) {
+		count = len(buffer)
+	}
+	start := (store.head + store.count - count) % len(store.ring)
+	copied := copy(buffer[:count], store.ring[start:])
+	if copied < count {
+		copy(buffer[copied:count], store.ring[:count-copied])
+	}
+	return count
+}
+
+// Read copies the most recent items, oldest first, into the buffer, as many
+// as its capacity holds, and returns it resliced. Only a nil buffer is
+// allocated, to the size of all items.
+func (store *IOStdStore) Read(buffer []Item) []Item {
 	store.lock.RLock()
 	defer store.lock.RUnlock()
-	if len(store.warehouse) == 0 {
-		return []string{}
+	if buffer == nil {
+		buffer = make([]Item, store.count)
 	}
-	var warehouse []string
-	if len(store.warehouse) > store.max {
-		warehouse = make([]string, store.max)
-		copy(warehouse, store.warehouse[(len(store.warehouse)-store.max):])
-	} else {
-		warehouse = make([]string, len(store.warehouse))
-		copy(warehouse, store.warehouse)
+	buffer = buffer[:cap(buffer)]
+	return buffer[:store.copyTo(buffer)]
+}
+
+func (store *IOStdStore) Len() int {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	return store.count
+}
+
+func (store *IOStdStore) Dropped() (uint64, uint64) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	return store.droppedLines, store.droppedBytes
+}
+
+// Lines returns how many items were appended, including dropped ones.
+func (store *IOStdStore) Lines() uint64 {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	return store.lines
+}
+
+func (store *IOStdStore) List(format TimeFormat) []string {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	warehouse := make([]string, store.count)
+	for idx := range warehouse {
+		warehouse[idx] = format.Render(store.ring[(store.head+idx)%len(store.ring)])
 	}
 	return warehouse
 }
 
-func NewIOStdStore(max int) *IOStdStore {
-	return &IOStdStore{max: max}
+func NewIOStdStore(max int, maxBytes int) *IOStdStore {
+	if max < 1 {
+		max = 1
+	}
+	return &IOStdStore{max: max, maxBytes: maxBytes}
 }
 
 const Stopped int = 0
@@ -62,10 +220,15 @@ type Status struct {
 	pid          int32
 	code         int32
 	state        int32
+	startTime    int64
+	crashLoop    int32
 	startupError error
 	stdOutStore  *IOStdStore
 	stdErrStore  *IOStdStore
+	entries      [Failed + 1]uint64
+	changed      chan struct{}
 	lock         sync.RWMutex
+	stateLock    sync.Mutex
 }
 
 func (status *Status) SetPid(pid int) {
@@ -84,8 +247,76 @@ func (status *Status) GetExitCode() int {
 	return int(atomic.LoadInt32(&status.code))
 }
 
+func (status *Status) SetStartTime(startTime time.Time) {
+	atomic.StoreInt64(&status.startTime, startTime.UnixNano())
+}
+
+// GetStartTime returns the zero time when the process never started.
+func (status *Status) GetStartTime() time.Time {
+	startTime := atomic.LoadInt64(&status.startTime)
+	if startTime == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, startTime)
+}
+
+// SetCrashLoop marks the process as crash looping and reports whether the
+// mark changed.
+func (status *Status) SetCrashLoop(crashLoop bool) bool {
+	var value int32
+	if crashLoop {
+		value = 1
+	}
+	return atomic.SwapInt32(&status.crashLoop, value) != value
+}
+
+func (status *Status) CrashLoop() bool {
+	return atomic.LoadInt32(&status.crashLoop) == 1
+}
+
+// SetState stores the state, counts how many times it was entered and wakes
+// up everyone waiting on Changed.
 func (status *Status) SetState(state int) {
-	atomic.SwapInt32(&status.state, int32(state))
+	status.stateLock.Lock()
+	defer status.stateLock.Unlock()
+	atomic.StoreInt32(&status.state, int32(state))
+	status.notify(state)
+}
+
+// CompareAndSwapState sets the state to "to" only when it is still "from".
+func (status *Status) CompareAndSwapState(from int, to int) bool {
+	status.stateLock.Lock()
+	defer status.stateLock.Unlock()
+	if !atomic.CompareAndSwapInt32(&status.state, int32(from), int32(to)) {
+		return false
+	}
+	status.notify(to)
+	return true
+}
+
+func (status *Status) notify(state int) {
+	if state >= 0 && state < len(status.entries) {
+		status.entries[state]++
+	}
+	close(status.changed)
+	status.changed = make(chan struct{})
+}
+
+// Entered returns how many times the state was set.
+func (status *Status) Entered(state int) uint64 {
+	status.stateLock.Lock()
+	defer status.stateLock.Unlock()
+	if state < 0 || state >= len(status.entries) {
+		return 0
+	}
+	return status.entries[state]
+}
+
+// Changed returns a channel which is closed on the next state change.
+func (status *Status) Changed() <-chan struct{} {
+	status.stateLock.Lock()
+	defer status.stateLock.Unlock()
+	return status.changed
 }
 
 func (status *Status) GetState() int {
@@ -104,22 +335,54 @@ func (status *Status) GetError() error {
 	return status.startupError
 }
 
-func (status *Status) AddStdOutItem(item string) {
+func (status *Status) AddStdOutItem(item Item) {
 	status.stdOutStore.Append(item)
 }
 
-func (status *Status) ListStdOutItems() []string {
-	return status.stdOutStore.List()
+func (status *Status) ListStdOutItems(format TimeFormat) []string {
+	return status.stdOutStore.List(format)
+}
+
+func (status *Status) StdOutLen() int {
+	return status.stdOutStore.Len()
+}
+
+func (status *Status) ReadStdOutItems(buffer []Item) []Item {
+	return status.stdOutStore.Read(buffer)
+}
+
+func (status *Status) StdOutDropped() (uint64, uint64) {
+	return status.stdOutStore.Dropped()
 }
 
-func (status *Status) AddStdErrItem(item string) {
+func (status *Status) StdOutLines() uint64 {
+	return status.stdOutStore.Lines()
+}
+
+func (status *Status) AddStdErrItem(item Item) {
 	status.stdErrStore.Append(item)
 }
 
-func (status *Status) ListStdErrItems() []string {
-	return status.stdErrStore.List()
+func (status *Status) ListStdErrItems(format TimeFormat) []string {
+	return status.stdErrStore.List(format)
+}
+
+func (status *Status) StdErrLen() int {
+	return status.stdErrStore.Len()
+}
+
+func (status *Status) ReadStdErrItems(buffer []Item) []Item {
+	return status.stdErrStore.Read(buffer)
+}
+
+func (status *Status) StdErrDropped() (uint64, uint64) {
+	return status.stdErrStore.Dropped()
+}
+
+func (status *Status) StdErrLines() uint64 {
+	return status.stdErrStore.Lines()
 }
 
-func New(max int) *Status {
-	return &Status{pid: 0, code: 0, startupError: nil, state: int32(Stopped), stdOutStore: NewIOStdStore(max), stdErrStore: NewIOStdStore(max)}
+func New(max int, maxBytes int) *Status {
+	return &Status{pid: 0, code: 0, startupError: nil, state: int32(Stopped), stdOutStore: NewIOStdStore(max, maxBytes), stdErrStore: NewIOStdStore(max, maxBytes), changed: make(chan struct{})}
 }
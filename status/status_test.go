@@ -0,0 +1,108 @@
+package status
+
+import (
+	"strings"
+	"testing"
+)
+
+func lines(items []Item) []string {
+	result := make([]string, len(items))
+	for idx, item := range items {
+		result[idx] = item.Line
+	}
+	return result
+}
+
+func appendLines(store *IOStdStore, values ...string) {
+	for _, value := range values {
+		store.Append(Item{Line: value, Message: value})
+	}
+}
+
+func TestIOStdStoreLineBound(t *testing.T) {
+	store := NewIOStdStore(3, 1024)
+	appendLines(store, "a", "b", "c", "d", "e")
+	if got := strings.Join(lines(store.Read(nil)), ","); got != "c,d,e" {
+		t.Errorf("items = %s, want c,d,e", got)
+	}
+	droppedLines, droppedBytes := store.Dropped()
+	if droppedLines != 2 || droppedBytes != 2 {
+		t.Errorf("Dropped() = %d, %d, want 2, 2", droppedLines, droppedBytes)
+	}
+	if store.Lines() != 5 {
+		t.Errorf("Lines() = %d, want 5", store.Lines())
+	}
+}
+
+func TestIOStdStoreByteBound(t *testing.T) {
+	store := NewIOStdStore(100, 10)
+	appendLines(store, "aaaa", "bbbb", "cccc")
+	if got := strings.Join(lines(store.Read(nil)), ","); got != "bbbb,cccc" {
+		t.Errorf("items = %s, want bbbb,cccc", got)
+	}
+	droppedLines, droppedBytes := store.Dropped()
+	if droppedLines != 1 || droppedBytes != 4 {
+		t.Errorf("Dropped() = %d, %d, want 1, 4", droppedLines, droppedBytes)
+	}
+}
+
+func TestIOStdStoreTruncatesLongLine(t *testing.T) {
+	store := NewIOStdStore(100, 10)
+	appendLines(store, "keep", strings.Repeat("x", 25))
+	items := store.Read(nil)
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want only the truncated line", len(items))
+	}
+	if items[0].Line != strings.Repeat("x", 10) || items[0].Message != items[0].Line {
+		t.Errorf("item = %q / %q, want the line cut to 10 bytes", items[0].Line, items[0].Message)
+	}
+	droppedLines, droppedBytes := store.Dropped()
+	if droppedLines != 1 || droppedBytes != 4+15 {
+		t.Errorf("Dropped() = %d, %d, want 1, 19", droppedLines, droppedBytes)
+	}
+}
+
+func TestIOStdStoreTruncatesOnRuneBoundary(t *testing.T) {
+	store := NewIOStdStore(10, 5)
+	appendLines(store, "abcdé")
+	if line := store.Read(nil)[0].Line; line != "abcd" {
+		t.Errorf("line = %q, want %q", line, "abcd")
+	}
+}
+
+func TestIOStdStoreRead(t *testing.T) {
+	store := NewIOStdStore(40, 1024)
+	for idx := 0; idx < 50; idx++ {
+		appendLines(store, string(rune('A'+idx%26)))
+	}
+	all := store.Read(nil)
+	if len(all) != 40 || all[0].Line != "K" || all[39].Line != "X" {
+		t.Fatalf("Read(nil) = %v", lines(all))
+	}
+	buffer := make([]Item, 0, 64)
+	if read := store.Read(buffer); len(read) != 40 || &read[0] != &buffer[:1][0] {
+		t.Errorf("Read did not use the buffer")
+	}
+	tail := store.Read(make([]Item, 3))
+	if got := strings.Join(lines(tail), ""); got != "VWX" {
+		t.Errorf("tail = %s, want VWX", got)
+	}
+	if empty := store.Read(make([]Item, 0)); len(empty) != 0 {
+		t.Errorf("Read into an empty buffer returned %d items", len(empty))
+	}
+	allocations := testing.AllocsPerRun(100, func() {
+		store.Read(buffer)
+	})
+	if allocations != 0 {
+		t.Errorf("Read allocates %v times", allocations)
+	}
+}
+
+func TestIOStdStoreList(t *testing.T) {
+	store := NewIOStdStore(2, 1024)
+	appendLines(store, "a", "b", "c")
+	list := store.List(TimeFormat{Mode: TimeLayout, Layout: "X", Prefix: "[", Suffix: "]"})
+	if strings.Join(list, ",") != "[X] b,[X] c" {
+		t.Errorf("List() = %q", list)
+	}
+}
@@ -0,0 +1,334 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/vvhq/exorsus/configuration"
+	"github.com/vvhq/exorsus/events"
+	"github.com/vvhq/exorsus/version"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const SignatureHeader string = "X-Exorsus-Signature"
+const EventHeader string = "X-Exorsus-Event"
+const DeliveryHeader string = "X-Exorsus-Delivery"
+
+var errShutdown = errors.New("retries cancelled by shutdown")
+
+// StdErrTail returns the last lines of stderr captured for an application.
+type StdErrTail func(name string, lines int) []string
+
+// Payload is the JSON body posted to a webhook.
+type Payload struct {
+	events.Event
+	Webhook string   `json:"webhook"`
+	Stderr  []string `json:"stderr"`
+}
+
+// permanentError marks a delivery which must not be retried.
+type permanentError struct {
+	err error
+}
+
+func (permanent *permanentError) Error() string {
+	return permanent.err.Error()
+}
+
+type deadLetter struct {
+	Time     time.Time `json:"time"`
+	Webhook  string    `json:"webhook"`
+	URL      string    `json:"url"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	Payload  Payload   `json:"payload"`
+}
+
+type hook struct {
+	config    configuration.Webhook
+	filter    events.Filter
+	payloads  chan Payload
+	client    *http.Client
+	delivered uint64
+	failed    uint64
+	done      chan struct{}
+}
+
+type WebhookStatus struct {
+	Name      string `json:"name"`
+	Delivered uint64 `json:"delivered"`
+	Failed    uint64 `json:"failed"`
+}
+
+// Dispatcher posts bus events to the configured webhooks. Every webhook has
+// its own queue, so a slow endpoint does not delay the others.
+type Dispatcher struct {
+	hooks          []*hook
+	bus            *events.Bus
+	subscription   *events.Subscription
+	stderr         StdErrTail
+	deadLetterPath string
+	deadLetterLock sync.Mutex
+	closing        chan struct{}
+	done           chan struct{}
+	logger         *logrus.Logger
+}
+
+// run builds the payloads as the events arrive, so the stderr tail is the
+// one of the moment the event was published and not of its delivery.
+func (dispatcher *Dispatcher) run() {
+	defer close(dispatcher.done)
+	for {
+		select {
+		case event := <-dispatcher.subscription.C:
+			var tail []string
+			tailed := false
+			for _, hook := range dispatcher.hooks {
+				if !hook.filter.Match(event) {
+					continue
+				}
+				if !tailed {
+					tail = dispatcher.tail(event)
+					tailed = true
+				}
+				payload := dispatcher.payload(hook, event, tail)
+				select {
+				case hook.payloads <- payload:
+				default:
+					dispatcher.fail(hook, payload, 0, errors.New("webhook queue full"))
+				}
+			}
+		case <-dispatcher.closing:
+			return
+		}
+	}
+}
+
+func (dispatcher *Dispatcher) deliver(hook *hook) {
+	defer close(hook.done)
+	for payload := range hook.payloads {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			dispatcher.fail(hook, payload, 0, err)
+			continue
+		}
+		attempts, err := dispatcher.post(hook, payload, body)
+		if err != nil {
+			dispatcher.fail(hook, payload, attempts, err)
+			continue
+		}
+		atomic.AddUint64(&hook.delivered, 1)
+	}
+}
+
+// post sends the body, retrying with a growing wait; retries stop early when
+// the dispatcher is closed.
+func (dispatcher *Dispatcher) post(hook *hook, payload Payload, body []byte) (int, error) {
+	var err error
+	retries := hook.config.GetRetries()
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(hook.config.GetRetryWait(attempt))
+			select {
+			case <-timer.C:
+			case <-dispatcher.closing:
+				timer.Stop()
+				return attempt, fmt.Errorf("%v (%s)", err, errShutdown.Error())
+			}
+		}
+		err = dispatcher.send(hook, payload, body)
+		if err == nil {
+			return attempt + 1, nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return attempt + 1, err
+		}
+	}
+	return retries + 1, err
+}
+
+// tail returns the most stderr lines any matching webhook asks for.
+func (dispatcher *Dispatcher) tail(event events.Event) []string {
+	if dispatcher.stderr == nil {
+		return nil
+	}
+	lines := 0
+	for _, hook := range dispatcher.hooks {
+		if hook.filter.Match(event) && hook.config.GetStderrLines() > lines {
+			lines = hook.config.GetStderrLines()
+		}
+	}
+	return dispatcher.stderr(event.Application, lines)
+}
+
+func (dispatcher *Dispatcher) payload(hook *hook, event events.Event, tail []string) Payload {
+	payload := Payload{Event: event, Webhook: hook.config.Name, Stderr: []string{}}
+	if lines := hook.config.GetStderrLines(); len(tail) > lines {
+		tail = tail[len(tail)-lines:]
+	}
+	if tail != nil {
+		payload.Stderr = tail
+	}
+	return payload
+}
+
+func (dispatcher *Dispatcher) send(hook *hook, payload Payload, body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, hook.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	for name, value := range hook.config.Headers {
+		request.Header.Set(name, value)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "exorsus/"+version.Version)
+	request.Header.Set(EventHeader, payload.Type)
+	request.Header.Set(DeliveryHeader, strconv.FormatUint(payload.ID, 10))
+	if hook.config.Secret != "" {
+		request.Header.Set(SignatureHeader, Sign(hook.config.Secret, body))
+	}
+	response, err := hook.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	responseBody, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("webhook failed: %s: %s", response.Status, strings.TrimSpace(string(responseBody)))
+	if response.StatusCode >= 400 && response.StatusCode < 500 &&
+		response.StatusCode != http.StatusRequestTimeout && response.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err: err}
+	}
+	return err
+}
+
+// fail logs the undelivered payload and appends it to the dead-letter file.
+func (dispatcher *Dispatcher) fail(hook *hook, payload Payload, attempts int, err error) {
+	atomic.AddUint64(&hook.failed, 1)
+	dispatcher.logger.
+		WithField("source", "webhooks").
+		WithField("webhook", hook.config.Name).
+		WithField("event", payload.Type).
+		WithField("process", payload.Application).
+		WithField("attempts", attempts).
+		WithField("error", err.Error()).
+		Error("Can not deliver webhook")
+	line, marshalErr := json.Marshal(deadLetter{
+		Time:     time.Now(),
+		Webhook:  hook.config.Name,
+		URL:      hook.config.URL,
+		Attempts: attempts,
+		Error:    err.Error(),
+		Payload:  payload})
+	if marshalErr != nil {
+		return
+	}
+	dispatcher.deadLetterLock.Lock()
+	defer dispatcher.deadLetterLock.Unlock()
+	file, openErr := os.OpenFile(dispatcher.deadLetterPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if openErr == nil {
+		_, openErr = file.Write(append(line, '\n'))
+		_ = file.Close()
+	}
+	if openErr != nil {
+		dispatcher.logger.
+			WithField("source", "webhooks").
+			WithField("path", dispatcher.deadLetterPath).
+			WithField("error", openErr.Error()).
+			Error("Can not write webhook dead letter")
+	}
+}
+
+func (dispatcher *Dispatcher) Status() []WebhookStatus {
+	var webhookStatus []WebhookStatus
+	if dispatcher == nil {
+		return webhookStatus
+	}
+	for _, hook := range dispatcher.hooks {
+		webhookStatus = append(webhookStatus, WebhookStatus{
+			Name:      hook.config.Name,
+			Delivered: atomic.LoadUint64(&hook.delivered),
+			Failed:    atomic.LoadUint64(&hook.failed)})
+	}
+	return webhookStatus
+}
+
+// Close stops taking events and delivers the queued ones without waiting
+// for retries; what can not be delivered goes to the dead-letter file.
+func (dispatcher *Dispatcher) Close() {
+	if dispatcher == nil {
+		return
+	}
+	dispatcher.bus.Unsubscribe(dispatcher.subscription)
+	close(dispatcher.closing)
+	<-dispatcher.done
+	for _, hook := range dispatcher.hooks {
+		close(hook.payloads)
+	}
+	for _, hook := range dispatcher.hooks {
+		<-hook.done
+	}
+}
+
+// Sign returns the signature header value for the body: "sha256=" followed
+// by the hex encoded HMAC-SHA256 of the body keyed with the secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// New returns nil when no webhooks are configured.
+func New(webhooks []configuration.Webhook, deadLetterPath string, bus *events.Bus, stderr StdErrTail, logger *logrus.Logger) *Dispatcher {
+	if len(webhooks) == 0 {
+		return nil
+	}
+	dispatcher := &Dispatcher{
+		bus:            bus,
+		stderr:         stderr,
+		deadLetterPath: deadLetterPath,
+		closing:        make(chan struct{}),
+		done:           make(chan struct{}),
+		logger:         logger}
+	for _, webhookConfig := range webhooks {
+		if webhookConfig.URL == "" {
+			logger.
+				WithField("source", "webhooks").
+				WithField("webhook", webhookConfig.Name).
+				Error("Skip webhook without URL")
+			continue
+		}
+		hook := &hook{
+			config:   webhookConfig,
+			filter:   events.Filter{Applications: webhookConfig.Applications, Types: webhookConfig.Events},
+			payloads: make(chan Payload, webhookConfig.GetBufferSize()),
+			client:   &http.Client{Timeout: webhookConfig.GetTimeout()},
+			done:     make(chan struct{})}
+		dispatcher.hooks = append(dispatcher.hooks, hook)
+		go dispatcher.deliver(hook)
+		logger.
+			WithField("source", "webhooks").
+			WithField("webhook", webhookConfig.Name).
+			WithField("url", webhookConfig.URL).
+			Info("Webhook configured")
+	}
+	dispatcher.subscription, _ = bus.Subscribe(events.Filter{}, 0)
+	go dispatcher.run()
+	return dispatcher
+}
@@ -0,0 +1,108 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"github.com/vvhq/exorsus/configuration"
+	"github.com/vvhq/exorsus/events"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	return logger
+}
+
+func waitStatus(t *testing.T, dispatcher *Dispatcher, delivered uint64, failed uint64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		webhookStatus := dispatcher.Status()
+		if webhookStatus[0].Delivered == delivered && webhookStatus[0].Failed == failed {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status = %+v, want %d delivered and %d failed", webhookStatus[0], delivered, failed)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStderrTailAtPublish(t *testing.T) {
+	release := make(chan struct{})
+	received := make(chan Payload, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		payload := Payload{}
+		_ = json.NewDecoder(request.Body).Decode(&payload)
+		received <- payload
+		<-release
+	}))
+	defer server.Close()
+
+	var lock sync.Mutex
+	current := "first"
+	tailed := make(chan struct{}, 2)
+	stderr := func(name string, lines int) []string {
+		lock.Lock()
+		defer lock.Unlock()
+		tailed <- struct{}{}
+		return []string{"old", current}
+	}
+	setTail := func(line string) {
+		lock.Lock()
+		current = line
+		lock.Unlock()
+	}
+
+	bus := events.NewBus(16)
+	webhooks := []configuration.Webhook{{Name: "hook", URL: server.URL, StderrLines: 1}}
+	dispatcher := New(webhooks, filepath.Join(t.TempDir(), "dead.log"), bus, stderr, testLogger())
+	defer dispatcher.Close()
+
+	bus.Publish(events.Event{Type: events.TypeCrashed, Application: "app"})
+	first := <-received
+	setTail("second")
+	bus.Publish(events.Event{Type: events.TypeCrashed, Application: "app"})
+	<-tailed
+	<-tailed
+	setTail("delivery")
+	close(release)
+	second := <-received
+
+	if len(first.Stderr) != 1 || first.Stderr[0] != "first" {
+		t.Errorf("first stderr = %q, want [first]", first.Stderr)
+	}
+	if len(second.Stderr) != 1 || second.Stderr[0] != "second" {
+		t.Errorf("second stderr = %q, want the tail when the event was published", second.Stderr)
+	}
+	waitStatus(t, dispatcher, 2, 0)
+}
+
+func TestStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		if request.Header.Get(EventHeader) == events.TypeCrashed {
+			responseWriter.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	bus := events.NewBus(16)
+	webhooks := []configuration.Webhook{{Name: "hook", URL: server.URL}}
+	dispatcher := New(webhooks, filepath.Join(t.TempDir(), "dead.log"), bus, nil, testLogger())
+	defer dispatcher.Close()
+
+	bus.Publish(events.Event{Type: events.TypeStarted, Application: "app"})
+	bus.Publish(events.Event{Type: events.TypeCrashed, Application: "app"})
+	waitStatus(t, dispatcher, 1, 1)
+
+	if webhookStatus := (*Dispatcher)(nil).Status(); len(webhookStatus) != 0 {
+		t.Errorf("nil dispatcher status = %+v, want none", webhookStatus)
+	}
+}
@@ -0,0 +1,293 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// The server side of RFC 6455, enough for the interactive endpoints: no
+// extensions and no subprotocols.
+
+const TextMessage int = 1
+const BinaryMessage int = 2
+const CloseMessage int = 8
+const PingMessage int = 9
+const PongMessage int = 10
+
+const CloseNormal int = 1000
+const CloseGoingAway int = 1001
+const CloseProtocolError int = 1002
+const CloseTooLarge int = 1009
+const CloseInternalError int = 1011
+
+const DefaultMaxMessageSize int64 = 1 << 20
+
+const acceptGUID string = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+const continuationFrame int = 0
+const closeTimeout time.Duration = time.Second
+
+// maxReasonSize is what a control frame payload leaves for the close reason
+// after the close code.
+const maxReasonSize int = 123
+
+var ErrClosed = errors.New("websocket closed")
+var ErrOrigin = errors.New("websocket origin not allowed")
+var errTooLarge = errors.New("websocket message too large")
+var errProtocol = errors.New("websocket protocol error")
+
+// Conn is a server connection. ReadMessage must be called from one goroutine
+// only; WriteMessage may be called from several.
+type Conn struct {
+	conn           net.Conn
+	reader         *bufio.Reader
+	maxMessageSize int64
+	writeLock      sync.Mutex
+	closeOnce      sync.Once
+}
+
+// IsUpgrade reports whether the request asks for a websocket.
+func IsUpgrade(request *http.Request) bool {
+	return headerContains(request.Header, "Connection", "upgrade") &&
+		headerContains(request.Header, "Upgrade", "websocket")
+}
+
+func headerContains(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckOrigin accepts a handshake without Origin, as sent by clients which
+// are not browsers, from the host the request was sent to, or from one of
+// the allowed origins such as "https://dashboard.example.com".
+func CheckOrigin(request *http.Request, allowed []string) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowedOrigin := range allowed {
+		if strings.EqualFold(strings.TrimSuffix(allowedOrigin, "/"), origin) {
+			return true
+		}
+	}
+	originURL, err := url.Parse(origin)
+	return err == nil && originURL.Host != "" && strings.EqualFold(originURL.Host, request.Host)
+}
+
+// Upgrade answers the handshake and takes over the connection; cross-origin
+// handshakes are refused unless the origin is allowed. On error a response
+// was written already.
+func Upgrade(responseWriter http.ResponseWriter, request *http.Request, allowedOrigins []string) (*Conn, error) {
+	key := request.Header.Get("Sec-Websocket-Key")
+	if request.Method != http.MethodGet || !IsUpgrade(request) || key == "" {
+		http.Error(responseWriter, "websocket handshake expected", http.StatusBadRequest)
+		return nil, errProtocol
+	}
+	if !CheckOrigin(request, allowedOrigins) {
+		http.Error(responseWriter, "websocket origin not allowed", http.StatusForbidden)
+		return nil, ErrOrigin
+	}
+	if request.Header.Get("Sec-Websocket-Version") != "13" {
+		responseWriter.Header().Set("Sec-Websocket-Version", "13")
+		http.Error(responseWriter, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errProtocol
+	}
+	hijacker, ok := responseWriter.(http.Hijacker)
+	if !ok {
+		http.Error(responseWriter, "websocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("connection can not be hijacked")
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	hash := sha1.Sum([]byte(key + acceptGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(hash[:]) + "\r\n\r\n"
+	if _, err = conn.Write([]byte(response)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return &Conn{conn: conn, reader: buffered.Reader, maxMessageSize: DefaultMaxMessageSize}, nil
+}
+
+func (conn *Conn) SetMaxMessageSize(size int64) {
+	conn.maxMessageSize = size
+}
+
+// ReadMessage returns the next text or binary message. Pings are answered
+// on the way; a close from the peer is answered and returns ErrClosed.
+func (conn *Conn) ReadMessage() (int, []byte, error) {
+	messageType := 0
+	var message []byte
+	for {
+		final, opcode, payload, err := conn.readFrame()
+		if err != nil {
+			if err == errTooLarge {
+				_ = conn.CloseWithReason(CloseTooLarge, err.Error())
+			} else if err == errProtocol {
+				_ = conn.CloseWithReason(CloseProtocolError, err.Error())
+			}
+			return 0, nil, err
+		}
+		switch opcode {
+		case PingMessage:
+			if err = conn.WriteMessage(PongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			code := CloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			_ = conn.CloseWithReason(code, "")
+			return 0, nil, ErrClosed
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, conn.protocolError()
+			}
+			messageType = opcode
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, conn.protocolError()
+			}
+		default:
+			return 0, nil, conn.protocolError()
+		}
+		if int64(len(message)+len(payload)) > conn.maxMessageSize {
+			_ = conn.CloseWithReason(CloseTooLarge, errTooLarge.Error())
+			return 0, nil, errTooLarge
+		}
+		message = append(message, payload...)
+		if final {
+			return messageType, message, nil
+		}
+	}
+}
+
+func (conn *Conn) protocolError() error {
+	_ = conn.CloseWithReason(CloseProtocolError, errProtocol.Error())
+	return errProtocol
+}
+
+func (conn *Conn) readFrame() (bool, int, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(conn.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	final := header[0]&0x80 != 0
+	opcode := int(header[0] & 0x0f)
+	if header[0]&0x70 != 0 || header[1]&0x80 == 0 {
+		// Reserved bits need an extension and client frames must be masked.
+		return false, 0, nil, errProtocol
+	}
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(conn.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(conn.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(extended[:]))
+	}
+	if opcode >= CloseMessage && (length > 125 || !final) {
+		return false, 0, nil, errProtocol
+	}
+	if length < 0 || length > conn.maxMessageSize {
+		return false, 0, nil, errTooLarge
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(conn.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(conn.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for idx := range payload {
+		payload[idx] ^= mask[idx%4]
+	}
+	return final, opcode, payload, nil
+}
+
+// WriteMessage sends the data as a single unmasked frame.
+func (conn *Conn) WriteMessage(messageType int, data []byte) error {
+	frame := make([]byte, 0, len(data)+10)
+	frame = append(frame, 0x80|byte(messageType))
+	switch {
+	case len(data) < 126:
+		frame = append(frame, byte(len(data)))
+	case len(data) <= 0xffff:
+		frame = append(frame, 126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(data)))
+	default:
+		frame = append(frame, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(data)))
+	}
+	frame = append(frame, data...)
+	conn.writeLock.Lock()
+	defer conn.writeLock.Unlock()
+	_, err := conn.conn.Write(frame)
+	return err
+}
+
+// truncateReason cuts the reason to fit a close frame, on a rune boundary
+// as the reason must be valid UTF-8.
+func truncateReason(reason string) string {
+	if len(reason) <= maxReasonSize {
+		return reason
+	}
+	cut := maxReasonSize
+	for cut > 0 && !utf8.RuneStart(reason[cut]) {
+		cut--
+	}
+	return reason[:cut]
+}
+
+// CloseWithReason sends a close frame and closes the connection; only the
+// first call has an effect.
+func (conn *Conn) CloseWithReason(code int, reason string) error {
+	err := ErrClosed
+	conn.closeOnce.Do(func() {
+		reason = truncateReason(reason)
+		payload := make([]byte, 2, 2+len(reason))
+		binary.BigEndian.PutUint16(payload, uint16(code))
+		payload = append(payload, reason...)
+		_ = conn.conn.SetWriteDeadline(time.Now().Add(closeTimeout))
+		_ = conn.WriteMessage(CloseMessage, payload)
+		err = conn.conn.Close()
+	})
+	return err
+}
+
+func (conn *Conn) Close() error {
+	return conn.CloseWithReason(CloseNormal, "")
+}
@@ -0,0 +1,200 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		origin  string
+		allowed []string
+		want    bool
+	}{
+		{"", nil, true},
+		{"http://exorsus.local:5202", nil, true},
+		{"https://EXORSUS.local:5202", nil, true},
+		{"http://evil.example", nil, false},
+		{"http://exorsus.local", nil, false},
+		{"https://dashboard.example.com", []string{"https://dashboard.example.com/"}, true},
+		{"https://dashboard.example.com", []string{"http://dashboard.example.com"}, false},
+		{"null", nil, false},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, "http://exorsus.local:5202/v1/attach/web", nil)
+		if test.origin != "" {
+			request.Header.Set("Origin", test.origin)
+		}
+		if got := CheckOrigin(request, test.allowed); got != test.want {
+			t.Errorf("CheckOrigin(%q, %q) = %v, want %v", test.origin, test.allowed, got, test.want)
+		}
+	}
+}
+
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dial sends a handshake and returns the response and, after a successful
+// upgrade, the client.
+func dial(t *testing.T, server *httptest.Server, origin string) (*http.Response, *testClient) {
+	t.Helper()
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	handshake := "GET / HTTP/1.1\r\nHost: " + server.Listener.Addr().String() + "\r\n" +
+		"Connection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"
+	if origin != "" {
+		handshake += "Origin: " + origin + "\r\n"
+	}
+	if _, err := conn.Write([]byte(handshake + "\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response, &testClient{conn: conn, reader: reader}
+}
+
+func (client *testClient) write(t *testing.T, final bool, opcode int, payload []byte) {
+	t.Helper()
+	first := byte(opcode)
+	if final {
+		first |= 0x80
+	}
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{first, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for idx, value := range payload {
+		frame = append(frame, value^mask[idx%4])
+	}
+	if _, err := client.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (client *testClient) read(t *testing.T) (int, []byte) {
+	t.Helper()
+	var header [2]byte
+	if _, err := client.reader.Read(header[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.reader.Read(header[1:]); err != nil {
+		t.Fatal(err)
+	}
+	payload := make([]byte, header[1]&0x7f)
+	for read := 0; read < len(payload); {
+		count, err := client.reader.Read(payload[read:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		read += count
+	}
+	return int(header[0] & 0x0f), payload
+}
+
+func echoServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		conn, err := Upgrade(responseWriter, request, []string{"https://dashboard.example.com"})
+		if err != nil {
+			return
+		}
+		conn.SetMaxMessageSize(16)
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			_ = conn.WriteMessage(messageType, message)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestUpgradeOrigin(t *testing.T) {
+	server := echoServer(t)
+	for origin, want := range map[string]int{
+		"":                              http.StatusSwitchingProtocols,
+		"https://dashboard.example.com": http.StatusSwitchingProtocols,
+		"http://" + server.Listener.Addr().String(): http.StatusSwitchingProtocols,
+		"https://evil.example":                      http.StatusForbidden,
+	} {
+		response, _ := dial(t, server, origin)
+		if response.StatusCode != want {
+			t.Errorf("origin %q: status %d, want %d", origin, response.StatusCode, want)
+		}
+		if want == http.StatusSwitchingProtocols && response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+			t.Errorf("origin %q: accept %q", origin, response.Header.Get("Sec-WebSocket-Accept"))
+		}
+	}
+}
+
+func TestMessages(t *testing.T) {
+	_, client := dial(t, echoServer(t), "")
+
+	client.write(t, true, TextMessage, []byte("hello"))
+	if opcode, payload := client.read(t); opcode != TextMessage || string(payload) != "hello" {
+		t.Errorf("echo = %d %q, want text hello", opcode, payload)
+	}
+
+	client.write(t, false, BinaryMessage, []byte("frag"))
+	client.write(t, true, PingMessage, []byte("ping"))
+	if opcode, payload := client.read(t); opcode != PongMessage || string(payload) != "ping" {
+		t.Errorf("ping answer = %d %q, want pong", opcode, payload)
+	}
+	client.write(t, true, continuationFrame, []byte("ment"))
+	if opcode, payload := client.read(t); opcode != BinaryMessage || string(payload) != "fragment" {
+		t.Errorf("echo = %d %q, want binary fragment", opcode, payload)
+	}
+
+	client.write(t, true, TextMessage, []byte(strings.Repeat("x", 17)))
+	opcode, payload := client.read(t)
+	if opcode != CloseMessage || len(payload) < 2 || int(binary.BigEndian.Uint16(payload)) != CloseTooLarge {
+		t.Errorf("answer to a large message = %d %q, want close %d", opcode, payload, CloseTooLarge)
+	}
+}
+
+func TestUnmaskedFrame(t *testing.T) {
+	_, client := dial(t, echoServer(t), "")
+	if _, err := client.conn.Write([]byte{0x80 | byte(TextMessage), 2, 'h', 'i'}); err != nil {
+		t.Fatal(err)
+	}
+	opcode, payload := client.read(t)
+	if opcode != CloseMessage || len(payload) < 2 || int(binary.BigEndian.Uint16(payload)) != CloseProtocolError {
+		t.Errorf("answer to an unmasked frame = %d %q, want close %d", opcode, payload, CloseProtocolError)
+	}
+}
+
+func TestTruncateReason(t *testing.T) {
+	tests := []struct {
+		reason string
+		want   string
+	}{
+		{"short", "short"},
+		{strings.Repeat("a", 130), strings.Repeat("a", 123)},
+		// "é" takes two bytes; the one starting at 122 would be cut in half.
+		{strings.Repeat("a", 122) + "éé", strings.Repeat("a", 122)},
+		{strings.Repeat("a", 121) + "éé", strings.Repeat("a", 121) + "é"},
+	}
+	for _, test := range tests {
+		got := truncateReason(test.reason)
+		if got != test.want || !utf8.ValidString(got) {
+			t.Errorf("truncateReason(%d bytes) = %d bytes %q, want %d bytes", len(test.reason), len(got), got, len(test.want))
+		}
+	}
+}